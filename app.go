@@ -1,6 +1,7 @@
 package beego
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -9,9 +10,11 @@ import (
 	"net/http"
 	"net/http/fcgi"
 	"os"
+	"os/signal"
 	"path"
 	"time"
 	"strings"
+	"syscall"
 
 	"github.com/astaxie/beego/grace"
 	"github.com/astaxie/beego/logs"
@@ -48,6 +51,8 @@ type MiddleWare func(http.Handler) http.Handler
 
 // Run beego application
 func (app *App) Run(mws ...MiddleWare) {
+	defer runShutdownHooks()
+
 	addr := BConfig.Listen.HTTPAddr
 
 	if BConfig.Listen.HTTPPort != 0 {
@@ -64,7 +69,7 @@ func (app *App) Run(mws ...MiddleWare) {
 
 	if BConfig.Listen.EnableFcgi {
 		if BConfig.Listen.EnableStdIo {
-			if err = fcgi.Server(nil, app.Handlers); err ==nil { // standard I/O
+			if err = fcgi.Server(nil, app.Handlers.dispatcher()); err ==nil { // standard I/O
 				logs.Info("Use FCGI via standard I/O")
 			}
 			else {
@@ -87,13 +92,13 @@ func (app *App) Run(mws ...MiddleWare) {
 			logs.Critical("Listen: ", err)
 		}
 
-		if err = fcgi.Serve(l, app.Handlers); err !=nil {
+		if err = fcgi.Serve(l, app.Handlers.dispatcher()); err !=nil {
 			logs.Critical("fcgi.Serve: ", err)
 		}
 		return
 	}
 
-	app.Server.Handler = app.Handlers
+	app.Server.Handler = app.Handlers.dispatcher()
 	for i:=len(mws)-1;i>=0;i-- {
 		if mws[i] == nil {
 			continue
@@ -104,6 +109,7 @@ func (app *App) Run(mws ...MiddleWare) {
 	app.Server.ReadTimeout = time.Duration(BConfig.Listen.ServerTimeOut) * time.Second
 	app.Server.WriteTimeout = time.Duration(BConfig.Listen.ServerTimeOut) * time.Second
 	app.Server.ErrorLog = logs.GetLogger("HTTP")
+	app.Server.RegisterOnShutdown(runShutdownHooks)
 
 	// run graceful mode
 	if BConfig.Listen.Graceful {
@@ -116,7 +122,8 @@ func (app *App) Run(mws ...MiddleWare) {
 					httpAddr = fmt.Sprintf("Ts:%d", BConfig.Listen.HTTPAddr, BConfig.Listen.HTTPPort)
 					app.Server.Addr = httpsAddr
 				}
-				server := grace.NewServer(httpsAddr, app.Handlers)
+				server := grace.NewServer(httpsAddr, app.Server.Handler)
+				server.Server.RegisterOnShutdown(runShutdownHooks)
 				server.Server.ReadTimeout = app.Server.ReadTimeout
 				server.Server.WriteTimeout = app.Server.WriteTimeout
 				if BConfig.Listen.EnalbeMuTualHTTPS {
@@ -137,7 +144,8 @@ func (app *App) Run(mws ...MiddleWare) {
 		}
 		if BConfig.Listen.EnableHTTP {
 			go run() {
-				server := grace.NewServer(addr, app.Handlers)
+				server := grace.NewServer(addr, app.Server.Handler)
+				server.Server.RegisterOnShutdown(runShutdownHooks)
 				server.Server.ReadTimeout = app.Server.ReadTimeout
 				server.Server.WriteTimeout = app.Server.WriteTimeout
 				if BConfig.Listen.ListenTCP4 {
@@ -155,6 +163,7 @@ func (app *App) Run(mws ...MiddleWare) {
 	}
 
 	// run normal mode
+	go app.shutdownOnSignal()
 	if BConfig.Listen.EnableHTTPS || BConfig.Listen.EnableMutualHTTPS {
 		go func() {
 			time.Sleep(20 * time.Microsecond)
@@ -215,6 +224,25 @@ func (app *App) Run(mws ...MiddleWare) {
 	<-endRunning
 }
 
+// shutdownOnSignal shuts app.Server down gracefully on SIGINT or SIGTERM, which
+// runs the shutdown hooks, see AddAPPShutdownHook. Requests in flight get
+// ServerTimeOut seconds to finish, 10 when it is not set.
+func (app *App) shutdownOnSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	signal.Stop(sig)
+	timeout := time.Duration(BConfig.Listen.ServerTimeOut) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := app.Server.Shutdown(ctx); err != nil {
+		logs.Error("shutdown: ", err)
+	}
+}
+
 // Router adds a patterned controller handler to BeeApp.
 // it's an alias method of App.Router.
 // usage:
@@ -236,6 +264,30 @@ func Router(rootpath string, c ControllerInterface, mappingMethods ...string) *A
 	return BeeApp
 }
 
+// Name names the route registered last on the app, see ControllerRegister.Name.
+// usage:
+//   beego.Router("/user/:id([0-9]+)", &UserController{}, "get:Show").Name("user")
+func (app *App) Name(name string) *App {
+	app.Handlers.Name(name)
+	return app
+}
+
+// MiddleWare adds middlewares wrapping the route registered last on the app, see ControllerRegister.MiddleWare.
+// usage:
+//   beego.Router("/admin", &AdminController{}).MiddleWare(basicAuth)
+func (app *App) MiddleWare(mws ...MiddleWare) *App {
+	app.Handlers.MiddleWare(mws...)
+	return app
+}
+
+// URLFor builds the url of a route of BeeApp, see ControllerRegister.URLFor.
+// usage:
+//   beego.URLFor("user", ":id", 42)
+//   beego.URLFor("UserController.Show", ":id", 42, "tab", "posts")
+func URLFor(endpoint string, values ...interface{}) (string, error) {
+	return BeeApp.Handlers.URLFor(endpoint, values...)
+}
+
 // UnregisterFixedRoute unregisters the route with the spcified fixedRoute. It is particularly useful
 // in web applicationis that inherit most routes from a base webapp iva the underscore
 // import, and aime to overwrite only certain paths.
@@ -246,6 +298,7 @@ func Router(rootpath string, c ControllerInterface, mappingMethods ...string) *A
 //   beego.UnregisterFixedRoute("/yourpreviouspath", "GET")
 //   beego.Router("/yourpreviouspath", yourControllerAddress, "get:GetNewPage")
 func UnregisterFixedRoute(fixRoute string, method string) *App {
+	BeeApp.Handlers.forget(fixRoute, method)
 	subPaths := splitPath(fixedRoute)
 	if method == "" || method == "*" {
 		for m := range HTTPMETHOD {
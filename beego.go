@@ -5,6 +5,10 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/astaxie/beego/session"
 )
 
 const (
@@ -16,9 +20,15 @@ const (
 type hookfunc func() error
 
 var (
-	hooks = make([]hookfunc, 0)
+	hooks         = make([]hookfunc, 0)
+	shutdownHooks = make([]hookfunc, 0)
+	shutdownOnce  sync.Once
 )
 
+func init() {
+	AddAPPShutdownHook(stopSessionJanitors)
+}
+
 // AddAPPStartHook is used to register the hookfunc
 // The hookfunc will run in beego.Run()
 // such as initiating sessin, starting middleware, building template, starting admin control and so on
@@ -26,6 +36,29 @@ func AddAPPStartHook(hf ...hookfunc) {
 	hooks = append(hooks, hf...)
 }
 
+// AddAPPShutdownHook is used to register the hookfunc
+// The hookfunc will run once, when the server shuts down on SIGINT or SIGTERM
+// or when App.Run returns, in the reverse order of registration
+// such as stopping the session janitor, flushing logs and so on
+func AddAPPShutdownHook(hf ...hookfunc) {
+	shutdownHooks = append(shutdownHooks, hf...)
+}
+
+func runShutdownHooks() {
+	shutdownOnce.Do(func() {
+		for i := len(shutdownHooks) - 1; i >= 0; i-- {
+			if err := shutdownHooks[i](); err != nil {
+				logs.Error("shutdown hook failed:", err)
+			}
+		}
+	})
+}
+
+func stopSessionJanitors() error {
+	session.StopJanitors()
+	return nil
+}
+
 // Run Beego application
 // beego.Run() default run on HttpPort
 // beego.Run("localhost")
@@ -81,6 +114,15 @@ func initBeforeHTTPRun() {
 			panic(err)
 		}
 	}
+
+	// BEEGO_DUMP_ROUTES=table or json prints the routes and exits instead of serving,
+	// e.g. to diff the route surface in CI
+	if format := os.Getenv("BEEGO_DUMP_ROUTES"); format != "" {
+		if err := BeeApp.Handlers.DumpRoutes(os.Stdout, format); err != nil {
+			panic(err)
+		}
+		os.Exit(0)
+	}
 }
 
 // TestBeegoInit is for test pacage init
@@ -177,6 +177,7 @@ func (c *Controller) RenderString (string, error) {
 
 // Renderbyptes returns the bytes of rendered template string. Do not send out response.
 func (c *Controller) RenderBytes() ([]byte, error) {
+	c.loadFlash()
 	buf, err := c.renderTemplate()
 	// if the controller has set layout, then first get the tplName's content set the content to the layout
 	if err == nil && c.Layout != "" {
@@ -202,3 +203,45 @@ func (c *Controller) RenderBytes() ([]byte, error) {
 	}
 	return buf.Bytes(), err
 }
+
+// StartSession starts session and load old session data info this controller.
+func (c *Controller) StartSession() session.Store {
+	if c.CruSession == nil {
+		c.CruSession = c.Ctx.Input.CruSession
+	}
+	return c.CruSession
+}
+
+// SetSession puts value into session.
+func (c *Controller) SetSession(name interface{}, value interface{}) {
+	if c.CruSession == nil {
+		c.StartSession()
+	}
+	c.CruSession.Set(name, value)
+}
+
+// GetSession gets value from session.
+func (c *Controller) GetSession(name interface{}) interface{} {
+	if c.CruSession == nil {
+		c.StartSession()
+	}
+	return c.CruSession.Get(name)
+}
+
+// DelSession removes value from session.
+func (c *Controller) DelSession(name interface{}) {
+	if c.CruSession == nil {
+		c.StartSession()
+	}
+	c.CruSession.Delete(name)
+}
+
+// CommitSession writes the session changes made so far before the response is written,
+// see session.Manager.SessionCommit. It returns session.ErrSessionConflict when a
+// parallel request changed a versioned session first.
+func (c *Controller) CommitSession() error {
+	if c.CruSession == nil {
+		return nil
+	}
+	return GlobalSessions.SessionCommit(c.Ctx.Request, c.CruSession)
+}
@@ -0,0 +1,120 @@
+package beego
+
+import (
+	"encoding/gob"
+	"fmt"
+)
+
+// flash message types, also the keys templates read them with, e.g. {{.flash.error}}
+const (
+	FlashSuccess = "success"
+	FlashNotice  = "notice"
+	FlashWarning = "warning"
+	FlashError   = "error"
+)
+
+// FlashData keeps one-shot messages in the session across a redirect, a list
+// of them for each type. A controller rendering a template puts the messages
+// waiting in the session in c.Data["flash"] on its own, see ReadFromRequest.
+// usage:
+//     func (c *LoginController) Post() {
+//         flash := beego.NewFlash()
+//         flash.Error("wrong password for %s", c.GetString("user"))
+//         flash.Store(&c.Controller)
+//         c.Redirect("/login", 302)
+//     }
+//
+//     // login.tpl
+//     {{range .flash.error}}<p class="error">{{.}}</p>{{end}}
+type FlashData struct {
+	Data map[string][]string
+}
+
+// NewFlash return a new empty FlashData struct.
+func NewFlash() *FlashData {
+	return &FlashData{
+		Data: make(map[string][]string),
+	}
+}
+
+// Set adds a message of type key to flash, after the ones of the type added before.
+func (fd *FlashData) Set(key string, msg string, args ...interface{}) {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	fd.Data[key] = append(fd.Data[key], msg)
+}
+
+// Success writes success message to flash.
+func (fd *FlashData) Success(msg string, args ...interface{}) {
+	fd.Set(FlashSuccess, msg, args...)
+}
+
+// Notice writes notice message to flash.
+func (fd *FlashData) Notice(msg string, args ...interface{}) {
+	fd.Set(FlashNotice, msg, args...)
+}
+
+// Warning writes warning message to flash.
+func (fd *FlashData) Warning(msg string, args ...interface{}) {
+	fd.Set(FlashWarning, msg, args...)
+}
+
+// Error writes error message to flash.
+func (fd *FlashData) Error(msg string, args ...interface{}) {
+	fd.Set(FlashError, msg, args...)
+}
+
+// Store saves the flash messages in the session for the next request to read,
+// after the messages stored earlier and not read yet.
+func (fd *FlashData) Store(c *Controller) {
+	data := pendingFlash(c)
+	for k, msgs := range fd.Data {
+		data[k] = append(data[k], msgs...)
+	}
+	c.SetSession(BConfig.WebConfig.FlashName, data)
+}
+
+// ReadFromRequest takes the flash messages out of the session, so they are shown only once,
+// and puts them in c.Data["flash"] for the templates. Rendering a template calls it
+// when the controller did not.
+func ReadFromRequest(c *Controller) *FlashData {
+	flash := NewFlash()
+	if data := pendingFlash(c); len(data) > 0 {
+		flash.Data = data
+		c.DelSession(BConfig.WebConfig.FlashName)
+	}
+	c.Data["flash"] = flash.Data
+	return flash
+}
+
+// pendingFlash returns a copy of the flash messages waiting in the session of c.
+// Sessions written before messages were kept in lists hold one message per type.
+func pendingFlash(c *Controller) map[string][]string {
+	data := make(map[string][]string)
+	switch pending := c.GetSession(BConfig.WebConfig.FlashName).(type) {
+	case map[string][]string:
+		for k, msgs := range pending {
+			data[k] = append([]string(nil), msgs...)
+		}
+	case map[string]string:
+		for k, msg := range pending {
+			data[k] = []string{msg}
+		}
+	}
+	return data
+}
+
+// loadFlash puts the flash messages in c.Data["flash"] before a template is
+// rendered, unless the controller read them already or has no session.
+func (c *Controller) loadFlash() {
+	if _, ok := c.Data["flash"]; ok || c.Ctx.Input.CruSession == nil {
+		return
+	}
+	ReadFromRequest(c)
+}
+
+func init() {
+	// sessions encoded with gob keep the messages as interface values
+	gob.Register(map[string][]string{})
+}
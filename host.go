@@ -0,0 +1,126 @@
+package beego
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hostParamsKey is the request context key of the parameters captured from the host.
+type hostParamsKey struct{}
+
+// hostRouter is the router of the requests to hosts matching pattern.
+type hostRouter struct {
+	pattern string
+	labels  []string // pattern split at the dots
+	router  *ControllerRegister
+}
+
+// Host returns the router for requests to hosts matching pattern, creating it
+// on first use. Routes, filters and namespaces are registered on it as on any
+// ControllerRegister. Requests to a host no pattern matches are served by p,
+// which makes p the fallback host.
+//
+// The host router runs the filters of p first, including the ones inserted
+// after it was created, and the middlewares of p around its own. So filters
+// and middlewares added to BeeApp.Handlers, e.g. for auth or CORS, cover every host.
+//
+// A pattern is a host name whose labels may be "*" to match any label or
+// ":name" to capture the label as host parameter, see HostParam. Patterns are
+// tried in the order they were added, after the ones without wildcards.
+// usage:
+//     admin := beego.BeeApp.Handlers.Host("admin.example.com")
+//     admin.Add("/", &AdminController{})
+//     tenant := beego.BeeApp.Handlers.Host(":tenant.example.com")
+//     tenant.AddNamespace(beego.NewNamespace("/api", beego.NSRouter("/user", &UserController{})))
+func (p *ControllerRegister) Host(pattern string) *ControllerRegister {
+	labels := strings.Split(strings.TrimSuffix(pattern, "."), ".")
+	for i, l := range labels {
+		if l == "" || l == ":" {
+			panic("beego: bad host pattern " + pattern)
+		}
+		if l[0] != ':' {
+			// host names are case insensitive, the names of parameters are not
+			labels[i] = strings.ToLower(l)
+		}
+	}
+	pattern = strings.Join(labels, ".")
+	for _, h := range p.hosts {
+		if h.pattern == pattern {
+			return h.router
+		}
+	}
+	h := &hostRouter{pattern: pattern, labels: labels, router: p.child()}
+	p.hosts = append(p.hosts, h)
+	return h.router
+}
+
+// matchHost returns the host router for host and the parameters it captured,
+// or nil when no pattern matches.
+func (p *ControllerRegister) matchHost(host string) (*hostRouter, map[string]string) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range p.hosts {
+		if h.pattern == host {
+			return h, nil
+		}
+	}
+	labels := strings.Split(host, ".")
+	for _, h := range p.hosts {
+		if params, ok := h.match(labels); ok {
+			return h, params
+		}
+	}
+	return nil, nil
+}
+
+func (h *hostRouter) match(labels []string) (map[string]string, bool) {
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, l := range h.labels {
+		switch {
+		case l == "*":
+		case l[0] == ':':
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[l[1:]] = labels[i]
+		case l != labels[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// dispatcher returns the handler serving the requests of p, which picks
+// the host router first and then the API version router when p has any, and
+// serves the request inside the middlewares of its route, see serveRoute.
+func (p *ControllerRegister) dispatcher() http.Handler {
+	if len(p.hosts) == 0 && len(p.versions) == 0 {
+		return http.HandlerFunc(p.serveRoute)
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		h, params := p.matchHost(r.Host)
+		if h == nil {
+			p.serveVersion(rw, r)
+			return
+		}
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), hostParamsKey{}, params))
+		}
+		h.router.serveVersion(rw, r)
+	})
+}
+
+// HostParam returns the host label captured as :name by the host pattern the request matched.
+// usage:
+//     tenant := beego.HostParam(c.Ctx.Request, "tenant")
+func HostParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(hostParamsKey{}).(map[string]string)
+	return params[name]
+}
@@ -0,0 +1,72 @@
+package beego
+
+import (
+	"net/http"
+
+	beecontext "github.com/astaxie/beego/context"
+)
+
+// Use adds middlewares wrapping every route of p, the ones registered before
+// and after the call. The first middleware is the outermost. They also wrap
+// the routes of the routers returned by Host and Version, outside of their own.
+//
+// Middlewares wrap the whole handling of the request once its route is found,
+// so for a request the order is:
+//     middlewares of the router, see Use
+//     middlewares of the namespaces, outermost namespace first, see Namespace.Use
+//     middlewares of the route, see MiddleWare
+//         BeforeStatic and BeforeRouter filters
+//         BeforeExec filters, the controller or function, AfterExec filters
+//         FinishRouter filters
+// A middleware that doesn't call the next handler answers the request itself,
+// the filters and the route are skipped.
+// Requests no route matches don't run any middleware.
+// usage:
+//     admin := beego.BeeApp.Handlers.Host("admin.example.com")
+//     admin.Use(requestID, basicAuth)
+func (p *ControllerRegister) Use(mws ...MiddleWare) {
+	p.middlewares = append(p.middlewares, mws...)
+}
+
+// MiddleWare adds middlewares wrapping the route registered last, inside the
+// middlewares of p and of its namespaces. The first middleware is the outermost.
+// usage:
+//     p.Add("/upload", &UploadController{})
+//     p.MiddleWare(limitBody, gzip)
+func (p *ControllerRegister) MiddleWare(mws ...MiddleWare) {
+	if len(p.infos) == 0 {
+		panic("beego: MiddleWare called before any route was registered")
+	}
+	r := p.infos[len(p.infos)-1]
+	r.middlewares = append(r.middlewares, mws...)
+}
+
+// chain returns the middlewares wrapping route r of p, outermost first: the ones
+// of the routers p was made from by child, the ones of p and the ones of r.
+func (p *ControllerRegister) chain(r *ControllerInfo) []MiddleWare {
+	mws := r.middlewares
+	for router := p; router != nil; router = router.parent {
+		if len(router.middlewares) > 0 {
+			mws = append(append([]MiddleWare(nil), router.middlewares...), mws...)
+		}
+	}
+	return mws
+}
+
+// serveRoute serves the request with p inside the middlewares of its route, see
+// chain and lookup. A request no route admits is served without any.
+// The dispatcher serves every request with it.
+func (p *ControllerRegister) serveRoute(rw http.ResponseWriter, r *http.Request) {
+	ctx := p.pool.Get().(*beecontext.Context)
+	ctx.Reset(rw, r)
+	router, route, _ := p.lookup(ctx, r.Method, r.URL.Path)
+	p.pool.Put(ctx)
+	var h http.Handler = p
+	if route != nil {
+		mws := router.chain(route)
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+	}
+	h.ServeHTTP(rw, r)
+}
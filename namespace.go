@@ -0,0 +1,495 @@
+package beego
+
+import (
+	"net/http"
+	"strings"
+
+	beecontext "github.com/astaxie/beego/context"
+)
+
+// NamespaceCond reports whether a request may reach the routes of a Namespace.
+type NamespaceCond func(*beecontext.Context) bool
+
+// LinkNamespace adds routes, filters or conditions to a Namespace.
+type LinkNamespace func(*Namespace)
+
+// Namespace groups routes under a shared prefix, with filters and conditions
+// that apply to every route inside. A Namespace only records what it holds,
+// its routes are registered once it is added to a ControllerRegister or mounted
+// under another Namespace, with the prefixes of all of them in front.
+//
+// Conditions are part of the match of each route of the namespace, so another
+// namespace or a route outside of any may route the same paths for the requests
+// the conditions turn away. The router checks them itself, however it is served.
+// Filters run for every path under the prefix, including paths routed outside
+// of the namespace, when the request meets the conditions.
+type Namespace struct {
+	prefix      string
+	conds       []NamespaceCond
+	filters     []func(p *ControllerRegister, prefix string)
+	routes      []func(p *ControllerRegister, prefix string)
+	middlewares []MiddleWare
+}
+
+// NewNamespace returns a Namespace for prefix.
+// usage:
+//     ns := beego.NewNamespace("/v2",
+//         beego.NSCond(beego.HostCond("api.example.com")),
+//         beego.NSNamespace("/admin",
+//             beego.NSBefore(auth),
+//             beego.NSRouter("/user", &AdminUserController{}),
+//         ),
+//     )
+//     beego.AddNamespace(ns)
+func NewNamespace(prefix string, params ...LinkNamespace) *Namespace {
+	n := &Namespace{prefix: prefix}
+	for _, p := range params {
+		p(n)
+	}
+	return n
+}
+
+// Cond adds conditions a request must meet to reach the routes of the namespace.
+// A request meeting them is served by the namespace, even for paths routed
+// outside of it first. A request failing one of them is served by a route
+// registered for the same path outside of the namespace, if any, and gets a
+// 404 otherwise.
+func (n *Namespace) Cond(conds ...NamespaceCond) *Namespace {
+	n.conds = append(n.conds, conds...)
+	return n
+}
+
+// Filter adds filters that run for every path under the namespace.
+// action is "before" to run them before the router or "after" to run them when the request is finished.
+func (n *Namespace) Filter(action string, filter ...FilterFunc) *Namespace {
+	pos := BeforeRouter
+	if action == "after" {
+		pos = FinishRouter
+	}
+	for _, f := range filter {
+		f := f
+		n.filters = append(n.filters, func(p *ControllerRegister, prefix string) {
+			conds := p.conds
+			p.insertFilterRouter(pos, newNamespaceFilter(prefix, func(ctx *beecontext.Context) {
+				if meets(ctx, conds) {
+					f(ctx)
+				}
+			}))
+		})
+	}
+	return n
+}
+
+// Router same as beego.Router, relative to the namespace
+func (n *Namespace) Router(rootpath string, c ControllerInterface, mappingMethods ...string) *Namespace {
+	return n.route(func(p *ControllerRegister, prefix string) {
+		p.Add(prefix+rootpath, c, mappingMethods...)
+	})
+}
+
+// AutoRouter same as beego.AutoRouter, relative to the namespace
+func (n *Namespace) AutoRouter(c ControllerInterface) *Namespace {
+	return n.route(func(p *ControllerRegister, prefix string) {
+		p.AddAutoPrefix(prefix, c)
+	})
+}
+
+// AutoPrefix same as beego.AutoPrefix, relative to the namespace
+func (n *Namespace) AutoPrefix(prefix string, c ControllerInterface) *Namespace {
+	return n.route(func(p *ControllerRegister, nsPrefix string) {
+		p.AddAutoPrefix(nsPrefix+prefix, c)
+	})
+}
+
+// Get same as beego.Get, relative to the namespace
+func (n *Namespace) Get(rootpath string, f FilterFunc) *Namespace {
+	return n.method("get", rootpath, f)
+}
+
+// Post same as beego.Post, relative to the namespace
+func (n *Namespace) Post(rootpath string, f FilterFunc) *Namespace {
+	return n.method("post", rootpath, f)
+}
+
+// Delete same as beego.Delete, relative to the namespace
+func (n *Namespace) Delete(rootpath string, f FilterFunc) *Namespace {
+	return n.method("delete", rootpath, f)
+}
+
+// Put same as beego.Put, relative to the namespace
+func (n *Namespace) Put(rootpath string, f FilterFunc) *Namespace {
+	return n.method("put", rootpath, f)
+}
+
+// Head same as beego.Head, relative to the namespace
+func (n *Namespace) Head(rootpath string, f FilterFunc) *Namespace {
+	return n.method("head", rootpath, f)
+}
+
+// Options same as beego.Options, relative to the namespace
+func (n *Namespace) Options(rootpath string, f FilterFunc) *Namespace {
+	return n.method("options", rootpath, f)
+}
+
+// Patch same as beego.Patch, relative to the namespace
+func (n *Namespace) Patch(rootpath string, f FilterFunc) *Namespace {
+	return n.method("patch", rootpath, f)
+}
+
+// Any same as beego.Any, relative to the namespace
+func (n *Namespace) Any(rootpath string, f FilterFunc) *Namespace {
+	return n.method("*", rootpath, f)
+}
+
+// Handler same as beego.Handler, relative to the namespace
+func (n *Namespace) Handler(rootpath string, h http.Handler, options ...interface{}) *Namespace {
+	return n.route(func(p *ControllerRegister, prefix string) {
+		p.Handler(prefix+rootpath, h, options...)
+	})
+}
+
+// Include same as beego.Include, the comment routes are relative to the namespace
+func (n *Namespace) Include(cList ...ControllerInterface) *Namespace {
+	return n.route(func(p *ControllerRegister, prefix string) {
+		p.include(prefix, cList...)
+	})
+}
+
+// Namespace mounts other namespaces under this one.
+// usage:
+//     ns := beego.NewNamespace("/v1").
+//         Namespace(
+//             beego.NewNamespace("/shop").Get("/:id", getShop),
+//             beego.NewNamespace("/order").Get("/:id", getOrder),
+//         )
+func (n *Namespace) Namespace(ns ...*Namespace) *Namespace {
+	for _, child := range ns {
+		child := child
+		n.route(func(p *ControllerRegister, prefix string) {
+			child.register(p, prefix)
+		})
+	}
+	return n
+}
+
+// Name names the route added last to the namespace, see ControllerRegister.Name.
+func (n *Namespace) Name(name string) *Namespace {
+	if len(n.routes) == 0 {
+		panic("beego: Name called before any route was added to the namespace")
+	}
+	last := n.routes[len(n.routes)-1]
+	n.routes[len(n.routes)-1] = func(p *ControllerRegister, prefix string) {
+		last(p, prefix)
+		p.Name(name)
+	}
+	return n
+}
+
+// Use adds middlewares wrapping every route of the namespace and of the
+// namespaces mounted under it, see ControllerRegister.Use for the order they run in.
+func (n *Namespace) Use(mws ...MiddleWare) *Namespace {
+	n.middlewares = append(n.middlewares, mws...)
+	return n
+}
+
+// MiddleWare adds middlewares wrapping the route added last to the namespace, see ControllerRegister.MiddleWare.
+func (n *Namespace) MiddleWare(mws ...MiddleWare) *Namespace {
+	if len(n.routes) == 0 {
+		panic("beego: MiddleWare called before any route was added to the namespace")
+	}
+	last := n.routes[len(n.routes)-1]
+	n.routes[len(n.routes)-1] = func(p *ControllerRegister, prefix string) {
+		last(p, prefix)
+		p.MiddleWare(mws...)
+	}
+	return n
+}
+
+func (n *Namespace) method(method, rootpath string, f FilterFunc) *Namespace {
+	return n.route(func(p *ControllerRegister, prefix string) {
+		p.AddMethod(method, prefix+rootpath, f)
+	})
+}
+
+// route adds fn registering a route. The route is reported at the call adding it
+// to the namespace, not at the one registering the namespace.
+func (n *Namespace) route(fn func(p *ControllerRegister, prefix string)) *Namespace {
+	site := callerSite()
+	n.routes = append(n.routes, func(p *ControllerRegister, prefix string) {
+		outer := p.site
+		p.site = site
+		fn(p, prefix)
+		p.site = outer
+	})
+	return n
+}
+
+// register adds the filters and routes of n under prefix to p. The routes and
+// filters get the conditions of n after the ones of the namespaces n is mounted
+// under, and the filters of n run before the ones of the namespaces mounted under
+// it. Likewise the middlewares of n wrap the ones of the namespaces mounted under it.
+func (n *Namespace) register(p *ControllerRegister, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/") + n.prefix
+	outer := p.conds
+	if len(n.conds) > 0 {
+		p.conds = append(append([]NamespaceCond(nil), outer...), n.conds...)
+	}
+	for _, fn := range n.filters {
+		fn(p, prefix)
+	}
+	start := len(p.infos)
+	for _, fn := range n.routes {
+		fn(p, prefix)
+	}
+	p.conds = outer
+	if len(n.middlewares) > 0 {
+		for _, r := range p.infos[start:] {
+			r.middlewares = append(append([]MiddleWare(nil), n.middlewares...), r.middlewares...)
+		}
+	}
+}
+
+// meets reports whether ctx meets every one of conds.
+func meets(ctx *beecontext.Context, conds []NamespaceCond) bool {
+	for _, cond := range conds {
+		if !cond(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the route for method and urlPath among the ones of p and of its
+// overflow routers whose namespace conditions ctx meets, with the router holding
+// it. A route with conditions comes before the ones without, so a namespace takes
+// the requests it admits even for paths routed outside of it first. Otherwise
+// routes are tried in the order they were registered. A nil ctx admits every
+// route. found reports whether any route matched, admitted or not.
+func (p *ControllerRegister) lookup(ctx *beecontext.Context, method, urlPath string) (router *ControllerRegister, route *ControllerInfo, found bool) {
+	if !BConfig.RouterCaseSensitive {
+		urlPath = strings.ToLower(urlPath)
+	}
+	mctx := p.pool.Get().(*beecontext.Context)
+	defer p.pool.Put(mctx)
+	for r := p; r != nil; r = r.overflow {
+		t, ok := r.routers[method]
+		if !ok {
+			continue
+		}
+		mctx.Input.ResetParams()
+		info, _ := t.Match(urlPath, mctx).(*ControllerInfo)
+		switch {
+		case info == nil:
+			continue
+		case len(info.conds) == 0:
+			if route == nil {
+				router, route = r, info
+			}
+		case ctx == nil || meets(ctx, info.conds):
+			return r, info, true
+		}
+		found = true
+	}
+	return router, route, found
+}
+
+// newNamespaceFilter returns a filter running f for prefix and every path under it.
+// The params matched by the filter are dropped again, so they don't show up in the route.
+func newNamespaceFilter(prefix string, f FilterFunc) *FilterRouter {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !BConfig.RouterCaseSensitive {
+		prefix = strings.ToLower(prefix)
+	}
+	mr := &FilterRouter{
+		tree:           NewTree(),
+		pattern:        prefix + "/*",
+		filterFunc:     f,
+		returnOnOutput: true,
+		resetParams:    true,
+	}
+	if prefix != "" {
+		mr.tree.AddRouter(prefix, true)
+	}
+	mr.tree.AddRouter(prefix+"/*", true)
+	return mr
+}
+
+// AddNamespace registers the routes of the namespaces with p.
+func (p *ControllerRegister) AddNamespace(nl ...*Namespace) {
+	for _, n := range nl {
+		n.register(p, "")
+	}
+}
+
+// AddNamespace registers the routes of the namespaces with BeeApp.
+func AddNamespace(nl ...*Namespace) *App {
+	BeeApp.Handlers.AddNamespace(nl...)
+	return BeeApp
+}
+
+// HostCond matches requests for one of hosts, compared without the port.
+func HostCond(hosts ...string) NamespaceCond {
+	return func(ctx *beecontext.Context) bool {
+		host := ctx.Input.Host()
+		for _, h := range hosts {
+			if strings.EqualFold(h, host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HeaderCond matches requests carrying the header key, with one of values if any are given.
+func HeaderCond(key string, values ...string) NamespaceCond {
+	return func(ctx *beecontext.Context) bool {
+		got := ctx.Input.Header(key)
+		if len(values) == 0 {
+			return got != ""
+		}
+		for _, v := range values {
+			if v == got {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MethodCond matches requests made with one of methods.
+func MethodCond(methods ...string) NamespaceCond {
+	return func(ctx *beecontext.Context) bool {
+		for _, m := range methods {
+			if strings.EqualFold(m, ctx.Input.Method()) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NSCond adds conditions to the namespace
+func NSCond(conds ...NamespaceCond) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Cond(conds...)
+	}
+}
+
+// NSBefore adds filters running before the router
+func NSBefore(filterList ...FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Filter("before", filterList...)
+	}
+}
+
+// NSAfter adds filters running when the request is finished
+func NSAfter(filterList ...FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Filter("after", filterList...)
+	}
+}
+
+// NSUse adds middlewares wrapping every route of the namespace
+func NSUse(mws ...MiddleWare) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Use(mws...)
+	}
+}
+
+// NSInclude calls Namespace.Include
+func NSInclude(cList ...ControllerInterface) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Include(cList...)
+	}
+}
+
+// NSRouter calls Namespace.Router
+func NSRouter(rootpath string, c ControllerInterface, mappingMethods ...string) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Router(rootpath, c, mappingMethods...)
+	}
+}
+
+// NSGet calls Namespace.Get
+func NSGet(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Get(rootpath, f)
+	}
+}
+
+// NSPost calls Namespace.Post
+func NSPost(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Post(rootpath, f)
+	}
+}
+
+// NSDelete calls Namespace.Delete
+func NSDelete(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Delete(rootpath, f)
+	}
+}
+
+// NSPut calls Namespace.Put
+func NSPut(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Put(rootpath, f)
+	}
+}
+
+// NSHead calls Namespace.Head
+func NSHead(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Head(rootpath, f)
+	}
+}
+
+// NSOptions calls Namespace.Options
+func NSOptions(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Options(rootpath, f)
+	}
+}
+
+// NSPatch calls Namespace.Patch
+func NSPatch(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Patch(rootpath, f)
+	}
+}
+
+// NSAny calls Namespace.Any
+func NSAny(rootpath string, f FilterFunc) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Any(rootpath, f)
+	}
+}
+
+// NSHandler calls Namespace.Handler
+func NSHandler(rootpath string, h http.Handler) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Handler(rootpath, h)
+	}
+}
+
+// NSAutoRouter calls Namespace.AutoRouter
+func NSAutoRouter(c ControllerInterface) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.AutoRouter(c)
+	}
+}
+
+// NSAutoPrefix calls Namespace.AutoPrefix
+func NSAutoPrefix(prefix string, c ControllerInterface) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.AutoPrefix(prefix, c)
+	}
+}
+
+// NSNamespace mounts a new namespace for prefix, built from params, under the namespace
+func NSNamespace(prefix string, params ...LinkNamespace) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Namespace(NewNamespace(prefix, params...))
+	}
+}
@@ -0,0 +1,259 @@
+package beego
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// paramTypes maps the types of typed route parameters, as in ":id:int", to the regex of their values.
+var paramTypes = map[string]string{
+	"int":    `[0-9]+`,
+	"string": `[\w]+`,
+	"alpha":  `[a-zA-Z]+`,
+	"alnum":  `[a-zA-Z0-9]+`,
+	"hex":    `[0-9a-fA-F]+`,
+	"uuid":   `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// AddParamType makes route parameters typed name, as in ":param:name", match regex.
+// It panics if name is not a word or regex does not compile.
+// usage:
+//     beego.AddParamType("date", `[0-9]{4}-[0-9]{2}-[0-9]{2}`)
+//     beego.Router("/report/:day:date", &ReportController{})
+func AddParamType(name, regex string) {
+	for i := 0; i < len(name); i++ {
+		if !isParamChar(name[i]) {
+			panic("beego: parameter type " + name + " is not a word")
+		}
+	}
+	regexp.MustCompile(regex)
+	paramTypes[name] = regex
+}
+
+// patternPart is a piece of a path segment of a route pattern,
+// either literal text or a parameter.
+type patternPart struct {
+	literal  string
+	param    string // name of the parameter without the colon, "" for literal text
+	regex    string // regex the value must match, "" for any value
+	optional bool   // ?:param
+	splat    bool   // the value may span several segments
+	typed    bool   // the regex comes from a constraint, as in :id:int or :slug:[a-z-]+
+}
+
+// parsePattern splits a route pattern into its path segments and their parts.
+//     "/cms_:id([0-9]+).html"  -> "cms_", :id matching [0-9]+, ".html"
+//     "/user/?:id:int"         -> "user" and an optional :id matching [0-9]+
+//     "/post/:slug:[a-z-]+"    -> "post" and :slug matching [a-z-]+, up to the end of the segment
+//     "/static/*.*"            -> "static" and :path, ".", :ext
+func parsePattern(pattern string) ([][]patternPart, error) {
+	var segments [][]patternPart
+	for _, seg := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		parts, err := parseSegment(seg)
+		if err != nil {
+			return nil, fmt.Errorf("beego: bad route pattern %q: %v", pattern, err)
+		}
+		segments = append(segments, parts)
+	}
+	return segments, nil
+}
+
+func parseSegment(seg string) ([]patternPart, error) {
+	switch seg {
+	case "*":
+		return []patternPart{{param: "splat", splat: true}}, nil
+	case "*.*":
+		return []patternPart{{param: "path", splat: true}, {literal: "."}, {param: "ext", regex: `[^.]+`}}, nil
+	}
+	var parts []patternPart
+	for i := 0; i < len(seg); {
+		optional := strings.HasPrefix(seg[i:], "?:")
+		if seg[i] != ':' && !optional {
+			j := i + 1
+			for j < len(seg) && seg[j] != ':' && !strings.HasPrefix(seg[j:], "?:") {
+				j++
+			}
+			parts = append(parts, patternPart{literal: seg[i:j]})
+			i = j
+			continue
+		}
+		if optional {
+			i++
+		}
+		i++
+		start := i
+		for i < len(seg) && isParamChar(seg[i]) {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("parameter without a name in %q", seg)
+		}
+		part := patternPart{param: seg[start:i], optional: optional}
+		if i < len(seg) && seg[i] == ':' {
+			j := i + 1
+			for j < len(seg) && isParamChar(seg[j]) {
+				j++
+			}
+			name := seg[i+1 : j]
+			if regex, ok := paramTypes[name]; ok {
+				part.regex = regex
+				i = j
+			} else if name != "" && (j == len(seg) || seg[j] == '(') {
+				return nil, fmt.Errorf("unknown parameter type %q", name)
+			} else {
+				// the rest of the segment is the regex
+				part.regex = seg[i+1:]
+				i = len(seg)
+			}
+			part.typed = true
+		}
+		if i < len(seg) && seg[i] == '(' {
+			if part.typed {
+				return nil, fmt.Errorf("parameter %q has both a type and a regex in %q", part.param, seg)
+			}
+			end, err := closingParen(seg, i)
+			if err != nil {
+				return nil, err
+			}
+			part.regex = seg[i+1 : end]
+			i = end + 1
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// expandConstraints rewrites the typed parameters of pattern, as in ":id:int"
+// or ":slug:[a-z-]+", into the ":id([0-9]+)" form the Tree matches.
+// Segments without typed parameters are kept as they are.
+func expandConstraints(pattern string) (string, error) {
+	if !strings.Contains(pattern, ":") {
+		return pattern, nil
+	}
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if seg == "" || !strings.Contains(seg, ":") {
+			continue
+		}
+		parts, err := parseSegment(seg)
+		if err != nil {
+			return "", fmt.Errorf("beego: bad route pattern %q: %v", pattern, err)
+		}
+		typed := false
+		for _, part := range parts {
+			typed = typed || part.typed
+		}
+		if !typed {
+			continue
+		}
+		seg = ""
+		for _, part := range parts {
+			switch {
+			case part.param == "":
+				seg += part.literal
+			case part.regex == "":
+				seg += optionalMark(part.optional) + ":" + part.param
+			default:
+				seg += optionalMark(part.optional) + ":" + part.param + "(" + part.regex + ")"
+			}
+		}
+		segs[i] = seg
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+func optionalMark(optional bool) string {
+	if optional {
+		return "?"
+	}
+	return ""
+}
+
+// closingParen returns the index of the parenthesis closing the one at open.
+func closingParen(s string, open int) (int, error) {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unbalanced parenthesis in %q", s)
+}
+
+func isParamChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// buildURL fills the parameters of pattern from params and returns the path,
+// with the params the pattern has no place for appended as query string.
+func buildURL(pattern string, params map[string]string) (string, error) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool)
+	var path []string
+	for _, parts := range segments {
+		seg := ""
+		for _, part := range parts {
+			if part.param == "" {
+				seg += part.literal
+				continue
+			}
+			v, ok := params[part.param]
+			if !ok || v == "" {
+				if part.optional || part.splat {
+					continue
+				}
+				return "", fmt.Errorf("beego: route %s needs the parameter :%s", pattern, part.param)
+			}
+			if part.regex != "" {
+				if ok, _ := regexp.MatchString("^(?:"+part.regex+")$", v); !ok {
+					return "", fmt.Errorf("beego: parameter :%s=%q of route %s does not match %s", part.param, v, pattern, part.regex)
+				}
+			}
+			used[part.param] = true
+			if part.splat {
+				seg += escapePath(v)
+			} else {
+				seg += url.PathEscape(v)
+			}
+		}
+		if seg != "" {
+			path = append(path, seg)
+		}
+	}
+	u := "/" + strings.Join(path, "/")
+	query := url.Values{}
+	for k, v := range params {
+		if !used[k] {
+			query.Set(k, v)
+		}
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
+// escapePath escapes every segment of a value that may span several segments.
+func escapePath(v string) string {
+	segs := strings.Split(v, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
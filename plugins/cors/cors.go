@@ -0,0 +1,229 @@
+// Package cors provides a filter answering Cross-Origin Resource Sharing requests.
+//
+// Usage:
+//     import "github.com/astaxie/beego/plugins/cors"
+//
+//     beego.InsertFilter("/api/*", beego.BeforeRouter, cors.Allow(&cors.Options{
+//         AllowOrigins:     []string{"https://*.example.com"},
+//         AllowCredentials: true,
+//         MaxAge:           time.Hour,
+//     }))
+//
+// The filter answers preflight requests itself, before routing. Filters of
+// different policies are checked in the order they were inserted and the first
+// one whose pattern matches decides, even when it turns the origin away, so
+// insert the policy of a more specific pattern first.
+package cors
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+)
+
+const (
+	headerOrigin           = "Origin"
+	headerRequestMethod    = "Access-Control-Request-Method"
+	headerRequestHeaders   = "Access-Control-Request-Headers"
+	headerAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAllowMethods     = "Access-Control-Allow-Methods"
+	headerAllowHeaders     = "Access-Control-Allow-Headers"
+	headerExposeHeaders    = "Access-Control-Expose-Headers"
+	headerMaxAge           = "Access-Control-Max-Age"
+
+	// decidedKey marks the requests a policy decided in the context data
+	decidedKey = "cors.decided"
+)
+
+// defaultAllowHeaders are allowed when Options.AllowHeaders is empty.
+var defaultAllowHeaders = []string{"Origin", "Accept", "Content-Type", "Authorization"}
+
+// Options is a CORS policy.
+type Options struct {
+	// AllowAllOrigins allows requests from every origin, it can't be combined
+	// with AllowCredentials.
+	AllowAllOrigins bool
+	// AllowOrigins lists the allowed origins, "*" in an origin matches any
+	// part of a host name, e.g. "https://*.example.com". The origin "*" is
+	// the same as AllowAllOrigins.
+	AllowOrigins []string
+	// AllowOriginRegexps lists regexes matching allowed origins, they must match the whole origin.
+	AllowOriginRegexps []string
+	// AllowCredentials lets requests carry cookies and HTTP authentication.
+	AllowCredentials bool
+	// AllowMethods lists the allowed methods. When empty, the methods Router
+	// has a route for on the requested path are allowed, with the routes of
+	// its host and API version routers, see beego.ControllerRegister.AllowedMethodsFor.
+	AllowMethods []string
+	// Router is the router the filter is inserted in, BeeApp.Handlers when nil.
+	Router *beego.ControllerRegister
+	// AllowHeaders lists the request headers allowed, "*" allows any.
+	// Origin, Accept, Content-Type and Authorization are allowed when empty.
+	AllowHeaders []string
+	// ExposeHeaders lists the response headers scripts may read.
+	ExposeHeaders []string
+	// MaxAge is how long a preflight answer may be cached, 0 leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// policy is Options ready to be applied to requests.
+type policy struct {
+	opts    Options
+	origins []*regexp.Regexp
+}
+
+// Allow returns a filter applying opts. It panics if a pattern of
+// AllowOriginRegexps does not compile, or if every origin is allowed with
+// credentials, which would let any site read the responses of a logged in user.
+func Allow(opts *Options) beego.FilterFunc {
+	p := &policy{opts: *opts}
+	if p.opts.Router == nil {
+		p.opts.Router = beego.BeeApp.Handlers
+	}
+	if len(p.opts.AllowHeaders) == 0 {
+		p.opts.AllowHeaders = defaultAllowHeaders
+	}
+	for _, origin := range opts.AllowOrigins {
+		if origin == "*" {
+			p.opts.AllowAllOrigins = true
+			continue
+		}
+		pattern := strings.Replace(regexp.QuoteMeta(origin), `\*`, `[^/]*`, -1)
+		p.origins = append(p.origins, regexp.MustCompile("^(?i)"+pattern+"$"))
+	}
+	for _, pattern := range opts.AllowOriginRegexps {
+		p.origins = append(p.origins, regexp.MustCompile("^(?:"+pattern+")$"))
+	}
+	if p.opts.AllowAllOrigins && p.opts.AllowCredentials {
+		panic("cors: AllowCredentials can't be used with every origin allowed, list the origins")
+	}
+	return p.filter
+}
+
+func (p *policy) filter(ctx *context.Context) {
+	if ctx.Input.GetData(decidedKey) != nil {
+		// a policy inserted before decided, a broader one must not overrule it
+		return
+	}
+	ctx.Input.SetData(decidedKey, true)
+	origin := ctx.Input.Header(headerOrigin)
+	if origin == "" {
+		return
+	}
+	if !p.opts.AllowAllOrigins {
+		// the answer depends on the origin, caches must keep them apart
+		ctx.Output.Header("Vary", headerOrigin)
+	}
+	if !p.allowOrigin(origin) {
+		return
+	}
+	preflight := ctx.Input.Method() == http.MethodOptions && ctx.Input.Header(headerRequestMethod) != ""
+	if preflight {
+		p.answerPreflight(ctx, origin)
+		return
+	}
+	p.setOrigin(ctx, origin)
+	if len(p.opts.ExposeHeaders) > 0 {
+		ctx.Output.Header(headerExposeHeaders, strings.Join(p.opts.ExposeHeaders, ", "))
+	}
+}
+
+// answerPreflight answers a preflight request, without CORS headers if the
+// requested method or headers are not allowed, so the browser refuses the request.
+func (p *policy) answerPreflight(ctx *context.Context, origin string) {
+	methods := p.opts.AllowMethods
+	if len(methods) == 0 {
+		methods = p.opts.Router.AllowedMethodsFor(ctx.Request)
+		if len(methods) == 0 {
+			// no route at all, leave the 404 to the router
+			return
+		}
+	}
+	if p.allowMethod(methods, ctx.Input.Header(headerRequestMethod)) && p.allowHeaders(ctx.Input.Header(headerRequestHeaders)) {
+		p.setOrigin(ctx, origin)
+		ctx.Output.Header(headerAllowMethods, strings.Join(methods, ", "))
+		if requested := ctx.Input.Header(headerRequestHeaders); requested != "" {
+			if p.allowAnyHeader() {
+				ctx.Output.Header(headerAllowHeaders, requested)
+			} else {
+				ctx.Output.Header(headerAllowHeaders, strings.Join(p.opts.AllowHeaders, ", "))
+			}
+		}
+		if p.opts.MaxAge > 0 {
+			ctx.Output.Header(headerMaxAge, strconv.FormatInt(int64(p.opts.MaxAge/time.Second), 10))
+		}
+	}
+	ctx.ResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin allows origin to read the response.
+func (p *policy) setOrigin(ctx *context.Context, origin string) {
+	if p.opts.AllowAllOrigins {
+		ctx.Output.Header(headerAllowOrigin, "*")
+	} else {
+		ctx.Output.Header(headerAllowOrigin, origin)
+	}
+	if p.opts.AllowCredentials {
+		ctx.Output.Header(headerAllowCredentials, "true")
+	}
+}
+
+func (p *policy) allowOrigin(origin string) bool {
+	if p.opts.AllowAllOrigins {
+		return true
+	}
+	for _, re := range p.origins {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) allowMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) allowAnyHeader() bool {
+	for _, h := range p.opts.AllowHeaders {
+		if h == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether every header of the comma separated list requested is allowed.
+func (p *policy) allowHeaders(requested string) bool {
+	if requested == "" || p.allowAnyHeader() {
+		return true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		allowed := false
+		for _, a := range p.opts.AllowHeaders {
+			if strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -97,6 +98,9 @@ type ControllerInfo struct {
 	routeType int
 	initialize func() ControllerInterface
 	methodParams []*param.MethodParam
+	name string
+	middlewares []MiddleWare // of the route and its namespaces, outermost first
+	conds []NamespaceCond // of the namespaces of the route, outermost first
 }
 
 // ControllerRegister contains registered router rules, controller handlers and filters
@@ -107,6 +111,22 @@ type ControllerRegister struct {
 	enableFilter bool
 	filters [FinishRoute + 1][]*FilterRouter
 	pool sync.Pool
+	infos []*ControllerInfo // every route in the order it was registered
+	entries []routeEntry // every route added to a tree, for introspection
+	shapes map[string]routeEntry // first route for the paths of each shape, to find shadowed routes
+	site string // registration site of the routes added by a namespace
+	conds []NamespaceCond // conditions of the routes added by a namespace
+	overflow *ControllerRegister // routes for paths p routes already, when one of them has conditions
+	handoff bool // whether p is an overflow router, served once its parent ran the BeforeRouter filters
+	routing bool // whether p has the filter of routeRequest
+	own int // filters of p itself at the end of its BeforeRouter filters, see ownFilter
+	hosts []*hostRouter // routers of host patterns, p serves the other hosts
+	versions map[string]*ControllerRegister // routers of API versions, p serves the unversioned paths
+	versioning VersionConfig
+	middlewares []MiddleWare // wrapping every route, outermost first
+	named map[string]*ControllerInfo
+	parent *ControllerRegister // router whose filters and middlewares p runs too, nil for the root
+	children []*ControllerRegister // routers made by child, which inherit the filters of p
 }
 
 // NewControllerRegister returns a new ControllerRegister.
@@ -114,6 +134,7 @@ func NewControllerRegister() *ControllerRegister {
 	cr := &ControllerRegister{
 		routes: make(map[string]*Tree),
 		policies: make(map[string]*Tree),
+		named: make(map[string]*ControllerInfo),
 	}
 	cr.pool.New = func() interface{} {
 		return beecontext.NewContext()
@@ -121,6 +142,46 @@ func NewControllerRegister() *ControllerRegister {
 	return cr
 }
 
+// child returns a new router serving a part of the requests of p, such as the
+// ones of a host. It runs the filters of p, the ones inserted before and after
+// it was made, in the order they were inserted, and the middlewares of p
+// around its own. The filters of p itself, see ownFilter, are left out.
+func (p *ControllerRegister) child() *ControllerRegister {
+	c := NewControllerRegister()
+	c.parent = p
+	c.enableFilter = p.enableFilter
+	for pos := range p.filters {
+		filters := p.filters[pos]
+		if pos == BeforeRouter {
+			filters = filters[:len(filters)-p.own]
+		}
+		c.filters[pos] = append([]*FilterRouter(nil), filters...)
+	}
+	p.children = append(p.children, c)
+	return c
+}
+
+// overflowRouter returns the router of the routes for paths p routes already,
+// creating it on first use. p hands the requests for them off to it from its
+// BeforeRouter filters, see routeRequest, so it only runs the later filters of p.
+func (p *ControllerRegister) overflowRouter() *ControllerRegister {
+	if p.overflow == nil {
+		p.overflow = p.child()
+		p.overflow.handoff = true
+		p.overflow.filters[BeforeStatic] = nil
+		p.overflow.filters[BeforeRouter] = nil
+	}
+	return p.overflow
+}
+
+// root returns the router p was made from by child, p itself if it is not a child.
+func (p *ControllerRegister) root() *ControllerRegister {
+	for p.parent != nil {
+		p = p.parent
+	}
+	return p
+}
+
 // Add controller hadler and pattern rules to ControllerRegister
 // usage:
 //      default methods is the same name as method
@@ -209,9 +270,31 @@ func (p *ControllerRegister) addWithMethodParams(pattern string, c ControllerInt
 }
 
 func (p *ControllerRegister) addToRouter(method, pattern string, r *ControllerInfo) {
+	if n := len(p.infos); n == 0 || p.infos[n-1] != r {
+		p.infos = append(p.infos, r)
+		if r.conds == nil {
+			r.conds = p.conds
+		}
+	}
+	pattern, err := expandConstraints(pattern)
+	if err != nil {
+		panic(err)
+	}
 	if !BConfig.RouterCaseSensitive {
 		pattern = strings.ToLower(pattern)
 	}
+	if !p.handoff && !p.routing {
+		p.routing = true
+		p.ownFilter(p.routeRequest)
+	}
+	if p.takenByCond(method, pattern, r) {
+		overflow := p.overflowRouter()
+		overflow.site = p.site
+		overflow.addToRouter(method, pattern, r)
+		overflow.site = ""
+		return
+	}
+	p.record(method, pattern, r)
 	if t, ok := p.routers[method]; ok {
 		t.AddRoute(pattern, r)
 	} else {
@@ -221,9 +304,116 @@ func (p *ControllerRegister) addToRouter(method, pattern string, r *ControllerIn
 	}
 }
 
+// Name names the route registered last, so URLFor can build its url by name.
+// usage:
+//     p.Add("/user/:id([0-9]+)", &UserController{}, "get:Show")
+//     p.Name("user")
+//     p.URLFor("user", ":id", 42, "tab", "posts") // /user/42?tab=posts
+func (p *ControllerRegister) Name(name string) {
+	if len(p.infos) == 0 {
+		panic("beego: Name called before any route was registered")
+	}
+	if p.root().namedRoute(name) != nil {
+		panic("beego: route name " + name + " is used twice")
+	}
+	r := p.infos[len(p.infos)-1]
+	r.name = name
+	p.named[name] = r
+}
+
+// URLFor builds the url of a route. endpoint is the name given with Name or
+// "Controller.Method", e.g. "UserController.Show". values are pairs of a
+// parameter name, with or without the colon, and its value. Parameters the
+// pattern has no place for are appended as query string.
+// It fails when the endpoint is unknown or a required parameter is missing
+// or does not match its regex.
+func (p *ControllerRegister) URLFor(endpoint string, values ...interface{}) (string, error) {
+	if len(values)%2 != 0 {
+		return "", fmt.Errorf("beego: URLFor %s needs pairs of parameter names and values", endpoint)
+	}
+	routes := p.endpoint(endpoint)
+	if len(routes) == 0 {
+		return "", fmt.Errorf("beego: URLFor found no route for %s", endpoint)
+	}
+	var firstErr error
+	for _, r := range routes {
+		params := make(map[string]string, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			params[strings.TrimPrefix(fmt.Sprint(values[i]), ":")] = fmt.Sprint(values[i+1])
+		}
+		u, err := buildURL(r.pattern, params)
+		if err == nil {
+			return u, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", firstErr
+}
+
+// endpoint returns the routes endpoint may refer to, the first one that can be built wins.
+// The routes of the host and version routers of p are included.
+func (p *ControllerRegister) endpoint(endpoint string) []*ControllerInfo {
+	if r := p.namedRoute(endpoint); r != nil {
+		return []*ControllerInfo{r}
+	}
+	dot := strings.LastIndex(endpoint, ".")
+	if dot < 0 {
+		return nil
+	}
+	return p.controllerRoutes(endpoint[:dot], endpoint[dot+1:])
+}
+
+// namedRoute returns the route named name on p or its children, or nil.
+func (p *ControllerRegister) namedRoute(name string) *ControllerInfo {
+	if r, ok := p.named[name]; ok {
+		return r
+	}
+	for _, c := range p.children {
+		if r := c.namedRoute(name); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// controllerRoutes returns the routes of p and its children running method of controller.
+func (p *ControllerRegister) controllerRoutes(controller, method string) []*ControllerInfo {
+	var routes []*ControllerInfo
+	for _, r := range p.infos {
+		if r.controllerType != nil && r.controllerType.Name() == controller && r.runs(method) {
+			routes = append(routes, r)
+		}
+	}
+	for _, c := range p.children {
+		routes = append(routes, c.controllerRoutes(controller, method)...)
+	}
+	return routes
+}
+
+// runs reports whether the route runs the controller method.
+// A route without method mapping runs the method named after the http method.
+func (r *ControllerInfo) runs(method string) bool {
+	if len(r.methods) == 0 {
+		return HTTPMETHOD[strings.ToUpper(method)]
+	}
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 // Include when the Runmode is dev will generate router file in therouter/auto.go from the controller
 // Include(&BankAccount{}, &OrderController{}, &RefundController{}, &ReceiptController{})
 func (p *ControllerRegister) Include(cList ...ControllerInterface) {
+	p.include("", cList...)
+}
+
+// include registers the comment routes of the controllers under prefix.
+func (p *ControllerRegister) include(prefix string, cList ...ControllerInterface) {
 	if BConfig.RunMode == DEV {
 		skip := make(map[string]bool, 10)
 		for _, c := range cList {
@@ -255,7 +445,7 @@ func (p *ControllerRegister) Include(cList ...ControllerInterface) {
 		key := t.PkgPath() + ":" + t.Name()
 		if comm, ok := GlobalControllerRouter[Key]; ok {
 			for _, a := range comm {
-				p.addWithMethodParams(a.router, c, a.MethodParams, strings.Join(a.AllowHTTPMethods, ",") + ":" + a.Method)
+				p.addWithMethodParams(prefix+a.router, c, a.MethodParams, strings.Join(a.AllowHTTPMethods, ",") + ":" + a.Method)
 			}
 		}
 	}
@@ -424,17 +614,22 @@ func (p *ControllerRegister) AddAutoPrefix(prefix string, c ControllerInterface)
 	}
 }
 
-// InserFilter Add a FilterFunc with patern rule and action constant.
+// InsertFilter Add a FilterFunc with patern rule and action constant.
 // params is for:
 //   1. setting the returnOnOutput value (false allows multiple filters to execute)
 //   2. determining whether or not params need to be reset
-func (p *ControllerRegister) InserFilter(pattern string, pos int, filter FilterFunc, params ...bool) error {
+func (p *ControllerRegister) InsertFilter(pattern string, pos int, filter FilterFunc, params ...bool) error {
 	mr := &FilterRoute {
 		tree: NewTree(),
 		pattern: pattern,
 		filterFunc: filter,
 		returnOnOutput: true,
 	}
+	pattern, err := expandConstraints(pattern)
+	if err != nil {
+		return err
+	}
+	mr.pattern = pattern
 	if !BConfig.RouterCaseSensitive {
 		mr.pattern = strings.ToLower(pattern)
 	}
@@ -449,3 +644,135 @@ func (p *ControllerRegister) InserFilter(pattern string, pos int, filter FilterF
 	mr.tree.AddRouter(pattern, true)
 	return p.insertFilterRouter(pos, mr)
 }
+
+// insertFilterRouter adds mr to the filters run at pos, by p and its children.
+func (p *ControllerRegister) insertFilterRouter(pos int, mr *FilterRouter) error {
+	if pos < BeforeStatic || pos > FinishRouter {
+		return fmt.Errorf("can not find your filter position")
+	}
+	p.enableFilter = true
+	switch filters := p.filters[pos]; {
+	case p.handoff && pos <= BeforeRouter:
+		// p serves requests the BeforeRouter filters of its parent ran for
+	case pos == BeforeRouter && p.own > 0:
+		n := len(filters) - p.own
+		p.filters[pos] = append(append(append([]*FilterRouter(nil), filters[:n]...), mr), filters[n:]...)
+	default:
+		p.filters[pos] = append(filters, mr)
+	}
+	for _, c := range p.children {
+		c.insertFilterRouter(pos, mr)
+	}
+	return nil
+}
+
+// ownFilter adds f as a BeforeRouter filter of p for every path. It runs after
+// every BeforeRouter filter inserted with InsertFilter, before and after it was
+// added, so e.g. CORS filters see the requests first, and the routers made by
+// child don't inherit it.
+func (p *ControllerRegister) ownFilter(f FilterFunc) {
+	mr := &FilterRouter{
+		tree: NewTree(),
+		pattern: "*",
+		filterFunc: f,
+		returnOnOutput: true,
+	}
+	mr.tree.AddRouter("*", true)
+	p.enableFilter = true
+	p.filters[BeforeRouter] = append(p.filters[BeforeRouter], mr)
+	p.own++
+}
+
+// AllowedMethods returns the http methods that have a route for urlPath, sorted.
+// OPTIONS is included whenever another method is, the router answers it on its own.
+func (p *ControllerRegister) AllowedMethods(urlPath string) []string {
+	return p.allowed(nil, urlPath)
+}
+
+// allowed returns the methods of AllowedMethods, counting only the routes whose
+// namespace conditions ctx meets, see lookup.
+func (p *ControllerRegister) allowed(ctx *beecontext.Context, urlPath string) []string {
+	var allowed []string
+	options := false
+	for method := range p.routers {
+		if _, route, _ := p.lookup(ctx, method, urlPath); route != nil {
+			allowed = append(allowed, method)
+			options = options || method == http.MethodOptions
+		}
+	}
+	if len(allowed) > 0 && !options {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// AllowedMethodsFor returns the http methods that have a route for the path of r,
+// sorted, on the router serving its host, see Host, and on the API version
+// routers of that one, see Version. A preflight request names no version, so
+// the methods of every version count. Routes whose namespace conditions r fails
+// don't count.
+func (p *ControllerRegister) AllowedMethodsFor(r *http.Request) []string {
+	router := p
+	if h, _ := p.matchHost(r.Host); h != nil {
+		router = h.router
+	}
+	ctx := p.pool.Get().(*beecontext.Context)
+	defer p.pool.Put(ctx)
+	ctx.Reset(nil, r)
+	allowed := router.allowed(ctx, r.URL.Path)
+	seen := make(map[string]bool, len(allowed))
+	for _, m := range allowed {
+		seen[m] = true
+	}
+	for _, vr := range router.versions {
+		for _, m := range vr.allowed(ctx, r.URL.Path) {
+			if !seen[m] {
+				seen[m] = true
+				allowed = append(allowed, m)
+			}
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// answerUnrouted answers a request that has no route for its method, but whose
+// path has routes for other methods: an OPTIONS request gets 204 and every other
+// method 405, both with the Allow header. Routes whose namespace conditions the
+// request fails are left out, so they stay hidden.
+// It reports false when no method has a route for the path.
+func (p *ControllerRegister) answerUnrouted(context *beecontext.Context, urlPath string) bool {
+	allowed := p.allowed(context, urlPath)
+	if len(allowed) == 0 {
+		return false
+	}
+	context.Output.Header("Allow", strings.Join(allowed, ", "))
+	if context.Input.Method() == http.MethodOptions {
+		context.ResponseWriter.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	exception("405", context)
+	return true
+}
+
+// routeRequest is the filter of every router with routes, see ownFilter. It leaves
+// the request to p when lookup picks a route of p for it, and serves it with the
+// overflow router holding the route lookup picks otherwise. A request no route
+// admits is answered by answerUnrouted when its path is routed for other methods,
+// and gets a 404 when its path is routed under namespace conditions it fails.
+// So the conditions hold however the router is served.
+func (p *ControllerRegister) routeRequest(ctx *beecontext.Context) {
+	urlPath := ctx.Request.URL.Path
+	router, route, found := p.lookup(ctx, ctx.Request.Method, urlPath)
+	switch {
+	case router == p:
+	case route != nil:
+		router.ServeHTTP(ctx.ResponseWriter, ctx.Request)
+		// the route may answer without writing, p must not serve the request too
+		ctx.ResponseWriter.Started = true
+	case p.answerUnrouted(ctx, urlPath):
+	case found:
+		exception("404", ctx)
+	}
+}
@@ -0,0 +1,305 @@
+package beego
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	beecontext "github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/logs"
+)
+
+// filterPositions names the filter execution points in the order they run.
+var filterPositions = [...]string{
+	BeforeStatic: "BeforeStatic",
+	BeforeRouter: "BeforeRouter",
+	BeforeExec:   "BeforeExec",
+	AfterExec:    "AfterExec",
+	FinishRouter: "FinishRouter",
+}
+
+// routeEntry is a route as it was added to the tree of one http method.
+type routeEntry struct {
+	method  string
+	pattern string
+	info    *ControllerInfo
+	site    string // file:line of the call that registered the route
+}
+
+// record keeps the entry of a route added to the tree of method and reports
+// when it is shadowed by a route registered before for the same paths.
+func (p *ControllerRegister) record(method, pattern string, r *ControllerInfo) {
+	e := routeEntry{method: method, pattern: pattern, info: r, site: p.site}
+	if e.site == "" {
+		e.site = callerSite()
+	}
+	p.entries = append(p.entries, e)
+	if p.shapes == nil {
+		p.shapes = make(map[string]routeEntry)
+	}
+	for _, shape := range routeShapes(method, pattern) {
+		prev, ok := p.shapes[shape]
+		if !ok {
+			p.shapes[shape] = e
+			continue
+		}
+		if prev.info == r {
+			continue
+		}
+		msg := fmt.Sprintf("beego: route %s %s registered at %s is shadowed by route %s %s registered at %s",
+			method, pattern, e.site, prev.method, prev.pattern, prev.site)
+		if BConfig.RunMode == DEV {
+			panic(msg)
+		}
+		logs.Warn(msg)
+	}
+}
+
+// takenByCond reports whether the paths of pattern for method are routed by
+// another route already and the two have different namespace conditions.
+// addToRouter adds such a route to the overflow router, so each gets its turn,
+// see lookup. Routes under the same conditions are left to record, which
+// reports the one registered last as shadowed.
+func (p *ControllerRegister) takenByCond(method, pattern string, r *ControllerInfo) bool {
+	for _, shape := range routeShapes(method, pattern) {
+		prev, ok := p.shapes[shape]
+		if !ok || prev.info == r || sameConds(prev.info.conds, r.conds) {
+			continue
+		}
+		if len(prev.info.conds) == 0 {
+			site := p.site
+			if site == "" {
+				site = callerSite()
+			}
+			logs.Info("beego: route %s %s registered at %s takes the requests meeting its namespace conditions from route %s %s registered at %s",
+				method, pattern, site, prev.method, prev.pattern, prev.site)
+		}
+		return true
+	}
+	return false
+}
+
+// sameConds reports whether a and b are the conditions of the same namespaces.
+// Conditions are funcs, so they compare by the slice register made for them.
+func sameConds(a, b []NamespaceCond) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// routeShapes returns keys that are equal for patterns matching the same paths
+// for method: the names of parameters don't matter, their regex does.
+// A pattern with optional parameters has a shape with and without each of them.
+// It returns nil for patterns that don't parse.
+func routeShapes(method, pattern string) []string {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return nil
+	}
+	shapes := []string{method + " "}
+	for _, parts := range segments {
+		seg := "/"
+		optional := false
+		for _, part := range parts {
+			switch {
+			case part.param == "":
+				seg += part.literal
+			case part.splat:
+				seg += "*"
+			default:
+				seg += ":(" + part.regex + ")"
+			}
+			optional = optional || part.optional
+		}
+		n := len(shapes)
+		for i := 0; i < n; i++ {
+			if optional {
+				shapes = append(shapes, shapes[i])
+			}
+			shapes[i] += seg
+		}
+	}
+	return shapes
+}
+
+// callerSite returns file:line of the first caller outside of this package.
+func callerSite() string {
+	pc := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(2, pc)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/astaxie/beego.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Host       string              `json:"host,omitempty"`    // host pattern of the route, empty for any other host
+	Version    string              `json:"version,omitempty"` // API version of the route, empty for unversioned routes
+	Method     string              `json:"method"`
+	Pattern    string              `json:"pattern"`
+	Name       string              `json:"name,omitempty"`
+	Kind       string              `json:"kind"`                 // "controller", "func" or "handler"
+	Controller string              `json:"controller,omitempty"` // package path and type of the controller
+	Action     string              `json:"action"`               // controller method, function or handler type run for the route
+	Filters    map[string][]string `json:"filters,omitempty"`    // patterns of the filters applying to the route, by position
+}
+
+// Routes returns every registered route, including the ones of host and API
+// version routers, sorted by host, pattern, version and method.
+// Filters apply to a route when their pattern matches the route pattern taken
+// as a path, which is only an approximation for routes with parameters.
+func (p *ControllerRegister) Routes() []RouteInfo {
+	ctx := beecontext.NewContext()
+	routes := make([]RouteInfo, 0, len(p.entries))
+	for _, e := range p.entries {
+		ri := RouteInfo{
+			Method:  e.method,
+			Pattern: e.pattern,
+			Name:    e.info.name,
+			Action:  e.info.action(e.method),
+		}
+		switch e.info.routeType {
+		case routerTypeRESTFul:
+			ri.Kind = "func"
+		case routerTypeHandler:
+			ri.Kind = "handler"
+		default:
+			ri.Kind = "controller"
+			ri.Controller = e.info.controllerType.PkgPath() + "." + e.info.controllerType.Name()
+		}
+		for pos, filters := range p.filters {
+			for _, f := range filters {
+				ctx.Input.ResetParams()
+				if f.ValidRouter(e.pattern, ctx) {
+					if ri.Filters == nil {
+						ri.Filters = make(map[string][]string)
+					}
+					ri.Filters[filterPositions[pos]] = append(ri.Filters[filterPositions[pos]], f.pattern)
+				}
+			}
+		}
+		routes = append(routes, ri)
+	}
+	for v, vr := range p.versions {
+		for _, ri := range vr.Routes() {
+			ri.Version = v
+			routes = append(routes, ri)
+		}
+	}
+	if p.overflow != nil {
+		routes = append(routes, p.overflow.Routes()...)
+	}
+	for _, h := range p.hosts {
+		for _, ri := range h.router.Routes() {
+			ri.Host = h.pattern
+			routes = append(routes, ri)
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		if routes[i].Version != routes[j].Version {
+			return routes[i].Version < routes[j].Version
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// action returns what the route runs for method.
+func (r *ControllerInfo) action(method string) string {
+	switch r.routeType {
+	case routerTypeRESTFul:
+		return runtime.FuncForPC(reflect.ValueOf(r.runFunction).Pointer()).Name()
+	case routerTypeHandler:
+		return fmt.Sprintf("%T", r.handler)
+	}
+	if a, ok := r.methods[method]; ok {
+		return a
+	}
+	if a, ok := r.methods["*"]; ok {
+		return a
+	}
+	return strings.Title(strings.ToLower(method))
+}
+
+// PrintRoutes writes the routes as a table, one line per route.
+func (p *ControllerRegister) PrintRoutes(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tMETHOD\tPATTERN\tVERSION\tNAME\tKIND\tACTION\tFILTERS")
+	for _, r := range p.Routes() {
+		action := r.Action
+		if r.Controller != "" {
+			action = r.Controller + "." + r.Action
+		}
+		var filters []string
+		for _, name := range filterPositions {
+			for _, pattern := range r.Filters[name] {
+				filters = append(filters, name+":"+pattern)
+			}
+		}
+		host := r.Host
+		if host == "" {
+			host = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", host, r.Method, r.Pattern, r.Version, r.Name, r.Kind, action, strings.Join(filters, " "))
+	}
+	return tw.Flush()
+}
+
+// WriteRoutesJSON writes the routes as an indented JSON array.
+func (p *ControllerRegister) WriteRoutesJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(p.Routes(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// DumpRoutes writes the routes in format, "table" or "json".
+func (p *ControllerRegister) DumpRoutes(w io.Writer, format string) error {
+	switch format {
+	case "table":
+		return p.PrintRoutes(w)
+	case "json":
+		return p.WriteRoutesJSON(w)
+	}
+	return fmt.Errorf("beego: unknown route dump format %q, it should be table or json", format)
+}
+
+// forget drops the entries of pattern for method, "" or "*" for all methods,
+// after the route was removed from the trees.
+func (p *ControllerRegister) forget(pattern, method string) {
+	pattern = "/" + strings.Trim(pattern, "/ ")
+	if !BConfig.RouterCaseSensitive {
+		pattern = strings.ToLower(pattern)
+	}
+	method = strings.ToUpper(method)
+	kept := p.entries[:0]
+	for _, e := range p.entries {
+		if "/"+strings.Trim(e.pattern, "/") == pattern && (method == "" || method == "*" || method == e.method) {
+			for _, shape := range routeShapes(e.method, e.pattern) {
+				if p.shapes[shape].info == e.info {
+					delete(p.shapes, shape)
+				}
+			}
+			continue
+		}
+		kept = append(kept, e)
+	}
+	p.entries = kept
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// ErrInspectUnsupported is returned by the administration methods of a Manager
+// whose provider does not implement Inspector.
+var ErrInspectUnsupported = errors.New("session: provider does not support inspection")
+
+// Sessions returns the metadata of every live session.
+func (manager *Manager) Sessions() ([]SessionInfo, error) {
+	inspector, ok := manager.base.(Inspector)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+	var infos []SessionInfo
+	err := inspector.SessionIterate(func(info SessionInfo, session Store) bool {
+		infos = append(infos, info)
+		return true
+	})
+	return infos, err
+}
+
+// FindSessions returns the ids of the live sessions storing value under key,
+// e.g. FindSessions("uid", 42) lists every session of user 42.
+func (manager *Manager) FindSessions(key, value interface{}) ([]string, error) {
+	inspector, ok := manager.base.(Inspector)
+	if !ok {
+		return nil, ErrInspectUnsupported
+	}
+	var sids []string
+	err := inspector.SessionIterate(func(info SessionInfo, session Store) bool {
+		if v := session.Get(key); v != nil && reflect.DeepEqual(v, value) {
+			sids = append(sids, info.SID)
+		}
+		return true
+	})
+	return sids, err
+}
+
+// RevokeSession destroys the session sid, logging its owner out.
+func (manager *Manager) RevokeSession(sid string) error {
+	return manager.destroy(context.Background(), sid)
+}
+
+// RevokeSessions destroys every session storing value under key and returns
+// how many were destroyed, e.g. RevokeSessions("uid", 42) forces user 42 to log in again.
+func (manager *Manager) RevokeSessions(key, value interface{}) (int, error) {
+	sids, err := manager.FindSessions(key, value)
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, sid := range sids {
+		if err := manager.destroy(context.Background(), sid); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
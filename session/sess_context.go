@@ -0,0 +1,132 @@
+package session
+
+import "context"
+
+// ContextProvider is the context aware version of Provider.
+// The context carries the deadline and cancellation of the request a call is made for,
+// so a slow store cannot hang the request.
+type ContextProvider interface {
+	SessionInit(gclifetime int64, config string) error
+	SessionRead(ctx context.Context, sid string) (Store, error)
+	SessionExist(ctx context.Context, sid string) (bool, error)
+	SessionRegenerate(ctx context.Context, oldsid, sid string) (Store, error)
+	SessionDestroy(ctx context.Context, sid string) error
+	SessionAll() int // get all active session
+	SessionGC()
+}
+
+var contextProvides = make(map[string]ContextProvider)
+
+// RegisterContextProvider makes a context aware session provider available by the provided name.
+// The name shares its namespace with the providers passed to Register.
+// If it is called twice with the same name or if provider is nil, it panics.
+func RegisterContextProvider(name string, provider ContextProvider) {
+	if provider == nil {
+		panic("session: RegisterContextProvider provider is nil")
+	}
+	_, dup := provides[name]
+	if _, ctxDup := contextProvides[name]; dup || ctxDup {
+		panic("session: Register called twice for provider " + name)
+	}
+	contextProvides[name] = provider
+}
+
+// BlockingProvider is implemented by providers whose calls wait on I/O, e.g. on
+// a network store, to have them raced against the request context even when it
+// has no deadline, see WrapProvider.
+type BlockingProvider interface {
+	Blocking() bool
+}
+
+// WrapProvider adapts a Provider to ContextProvider.
+// When ctx has a deadline, e.g. one set by ProviderTimeout, or the provider is
+// a BlockingProvider, a call returns ctx.Err() as soon as ctx is done and the
+// wrapped call keeps running in the background until the provider returns.
+// Other calls are made directly, only failing when ctx is done before they start,
+// so fast providers like memory don't pay for a goroutine per call.
+func WrapProvider(provider Provider) ContextProvider {
+	a := &providerAdapter{provider: provider}
+	if b, ok := provider.(BlockingProvider); ok {
+		a.blocking = b.Blocking()
+	}
+	return a
+}
+
+type providerAdapter struct {
+	provider Provider
+	blocking bool
+}
+
+func (a *providerAdapter) SessionInit(gclifetime int64, config string) error {
+	return a.provider.SessionInit(gclifetime, config)
+}
+
+func (a *providerAdapter) SessionRead(ctx context.Context, sid string) (Store, error) {
+	var session Store
+	err := a.call(ctx, func() (err error) {
+		session, err = a.provider.SessionRead(sid)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (a *providerAdapter) SessionExist(ctx context.Context, sid string) (bool, error) {
+	var exist bool
+	err := a.call(ctx, func() error {
+		exist = a.provider.SessionExist(sid)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return exist, nil
+}
+
+func (a *providerAdapter) SessionRegenerate(ctx context.Context, oldsid, sid string) (Store, error) {
+	var session Store
+	err := a.call(ctx, func() (err error) {
+		session, err = a.provider.SessionRegenerate(oldsid, sid)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (a *providerAdapter) SessionDestroy(ctx context.Context, sid string) error {
+	return a.call(ctx, func() error {
+		return a.provider.SessionDestroy(sid)
+	})
+}
+
+func (a *providerAdapter) SessionAll() int {
+	return a.provider.SessionAll()
+}
+
+func (a *providerAdapter) SessionGC() {
+	a.provider.SessionGC()
+}
+
+// call runs fn, raced against ctx when the call may outlive it, see WrapProvider.
+func (a *providerAdapter) call(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, deadline := ctx.Deadline(); !deadline && !a.blocking {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
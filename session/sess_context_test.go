@@ -0,0 +1,39 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type slowProvider struct {
+	*MemProvider
+	delay time.Duration
+}
+
+func (pder *slowProvider) SessionExist(sid string) bool {
+	time.Sleep(pder.delay)
+	return false
+}
+
+func TestWrapProviderRacesDeadline(t *testing.T) {
+	pder := WrapProvider(&slowProvider{newMemProvider(1), time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pder.SessionExist(ctx, "sid"); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWrapProviderCallsDirectly(t *testing.T) {
+	pder := WrapProvider(&slowProvider{newMemProvider(1), 0})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	direct := testing.AllocsPerRun(100, func() { pder.SessionExist(ctx, "sid") })
+	ctx, cancel = context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	raced := testing.AllocsPerRun(100, func() { pder.SessionExist(ctx, "sid") })
+	if direct >= raced {
+		t.Fatalf("a call without deadline made %v allocations, %v with one, want it made directly", direct, raced)
+	}
+}
@@ -0,0 +1,77 @@
+package session
+
+import "sync"
+
+// Event describes a change in the lifecycle of a session.
+type Event struct {
+	SID    string                      // id of the session, the new id for OnRegenerate
+	OldSID string                      // previous id, only set for OnRegenerate
+	Values map[interface{}]interface{} // copy of the session values, nil if the store is not a Snapshotter
+}
+
+// EventFunc handles a session lifecycle event.
+// It runs synchronously in the goroutine that caused the event.
+type EventFunc func(Event)
+
+const (
+	eventCreate = iota
+	eventRegenerate
+	eventDestroy
+	eventExpire
+	eventKinds
+)
+
+// events holds the lifecycle hooks of a Manager.
+type events struct {
+	lock     sync.RWMutex
+	handlers [eventKinds][]EventFunc
+}
+
+// OnCreate registers fn to run when a new session is started.
+func (manager *Manager) OnCreate(fn EventFunc) {
+	manager.events.add(eventCreate, fn)
+}
+
+// OnRegenerate registers fn to run when a session gets a new id.
+func (manager *Manager) OnRegenerate(fn EventFunc) {
+	manager.events.add(eventRegenerate, fn)
+}
+
+// OnDestroy registers fn to run when a session is destroyed through the Manager.
+func (manager *Manager) OnDestroy(fn EventFunc) {
+	manager.events.add(eventDestroy, fn)
+}
+
+// OnExpire registers fn to run when the provider drops an expired or evicted session.
+// It only fires for providers implementing ExpiryNotifier.
+func (manager *Manager) OnExpire(fn EventFunc) {
+	manager.events.add(eventExpire, fn)
+}
+
+func (e *events) add(kind int, fn EventFunc) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.handlers[kind] = append(e.handlers[kind], fn)
+}
+
+// fire runs the hooks of kind for session, the snapshot is only taken when there are hooks.
+func (e *events) fire(kind int, session Store, oldsid string) {
+	e.lock.RLock()
+	handlers := e.handlers[kind]
+	e.lock.RUnlock()
+	if len(handlers) == 0 {
+		return
+	}
+	ev := Event{SID: session.SessionID(), OldSID: oldsid}
+	if s, ok := session.(Snapshotter); ok {
+		ev.Values = s.Snapshot()
+	}
+	for _, fn := range handlers {
+		fn(ev)
+	}
+}
+
+// expired is the ExpiryNotifier handler of the Manager.
+func (manager *Manager) expired(session Store) {
+	manager.events.fire(eventExpire, session, "")
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// keys the Manager keeps in every session it issues
+const (
+	issuedKey      = "_session_issued"      // unix time the current id was issued
+	fingerprintKey = "_session_fingerprint" // client fingerprint the session is bound to
+)
+
+// issue marks session as issued now to the client of r.
+func (manager *Manager) issue(session Store, r *http.Request) {
+	session.Set(issuedKey, time.Now().Unix())
+	if fp := manager.fingerprint(r); fp != "" {
+		session.Set(fingerprintKey, fp)
+	} else {
+		session.Delete(fingerprintKey)
+	}
+}
+
+// trusted reports whether session may be resumed by the client of r.
+// The fingerprint is checked whether or not the session carries the issued
+// mark, so a session made by GetSessionStore or read back from a store that
+// lost the mark is still bound to its client.
+func (manager *Manager) trusted(session Store, r *http.Request) bool {
+	if _, ok := issuedAt(session); !ok && manager.config.RejectUnissuedSid {
+		SLogger.Println("rejected a session id that was not issued by this server")
+		return false
+	}
+	fp, _ := session.Get(fingerprintKey).(string)
+	if fp != manager.fingerprint(r) {
+		SLogger.Println("rejected a session presented by a different client")
+		return false
+	}
+	return true
+}
+
+// issuedAt returns the unix time the id of session was issued. Stores that
+// serialize as JSON give the mark back as float64 or json.Number.
+func issuedAt(session Store) (int64, bool) {
+	switch issued := session.Get(issuedKey).(type) {
+	case int64:
+		return issued, true
+	case int:
+		return int64(issued), true
+	case float64:
+		return int64(issued), true
+	case json.Number:
+		n, err := issued.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// resumable reports whether the existing session sid may be resumed by the client of r.
+func (manager *Manager) resumable(ctx context.Context, sid string, r *http.Request) bool {
+	if exist, err := manager.provider.SessionExist(ctx, sid); err != nil || !exist {
+		return false
+	}
+	session, err := manager.provider.SessionRead(ctx, sid)
+	return err == nil && manager.trusted(session, r)
+}
+
+// rotationDue reports whether the id of session is older than RotateInterval.
+func (manager *Manager) rotationDue(session Store) bool {
+	if manager.config.RotateInterval <= 0 {
+		return false
+	}
+	issued, ok := issuedAt(session)
+	return ok && time.Now().Unix()-issued >= manager.config.RotateInterval
+}
+
+// fingerprint identifies the client of r by the attributes sessions are bound to,
+// it is empty when no binding is configured.
+func (manager *Manager) fingerprint(r *http.Request) string {
+	if !manager.config.BindUserAgent && manager.config.BindIPv4Prefix == 0 && manager.config.BindIPv6Prefix == 0 {
+		return ""
+	}
+	h := sha256.New()
+	if manager.config.BindUserAgent {
+		io.WriteString(h, r.UserAgent())
+	}
+	h.Write([]byte{0})
+	io.WriteString(h, manager.clientNetwork(r))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clientNetwork returns the configured prefix of the remote address of r.
+func (manager *Manager) clientNetwork(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if manager.config.BindIPv4Prefix == 0 {
+			return ""
+		}
+		return ip4.Mask(net.CIDRMask(manager.config.BindIPv4Prefix, 32)).String()
+	}
+	if manager.config.BindIPv6Prefix == 0 {
+		return ""
+	}
+	return ip.Mask(net.CIDRMask(manager.config.BindIPv6Prefix, 128)).String()
+}
@@ -0,0 +1,29 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedChecksFingerprintWithoutIssuedMark(t *testing.T) {
+	manager := &Manager{config: &ManagerConfig{BindUserAgent: true}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "owner")
+	st := &MemSessionStore{sid: "sid", value: make(map[interface{}]interface{}), pder: newMemProvider(1)}
+	st.Set(fingerprintKey, manager.fingerprint(r))
+	if !manager.trusted(st, r) {
+		t.Fatal("the owner was rejected")
+	}
+	r.Header.Set("User-Agent", "thief")
+	if manager.trusted(st, r) {
+		t.Fatal("a session without the issued mark was resumed by another client")
+	}
+}
+
+func TestIssuedAtReadsJSONNumbers(t *testing.T) {
+	st := &MemSessionStore{sid: "sid", value: make(map[interface{}]interface{}), pder: newMemProvider(1)}
+	st.Set(issuedKey, float64(1500000000))
+	if issued, ok := issuedAt(st); !ok || issued != 1500000000 {
+		t.Fatalf("got %d, %v", issued, ok)
+	}
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// signatureLength is the number of HMAC bytes appended to a signed session id.
+const signatureLength = 16
+
+// IDGenerator creates new session ids.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// HexIDGenerator creates ids of Length random bytes encoded as hex.
+// It is the default generator, with Length taken from sessionIDLength.
+type HexIDGenerator struct {
+	Length int
+}
+
+// NewID returns a new hex encoded random id.
+func (g HexIDGenerator) NewID() (string, error) {
+	b, err := randomBytes(g.Length)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Base64IDGenerator creates ids of Length random bytes encoded as unpadded base64url,
+// a third shorter than hex for the same entropy.
+type Base64IDGenerator struct {
+	Length int
+}
+
+// NewID returns a new base64url encoded random id.
+func (g Base64IDGenerator) NewID() (string, error) {
+	b, err := randomBytes(g.Length)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PrefixIDGenerator prepends Prefix and an optional shard hint to the ids of Generator,
+// e.g. "eu1.07.f3a9...". Shard returns the hint for a new id, such as the store shard
+// that should hold it, so the id can be routed without a lookup.
+type PrefixIDGenerator struct {
+	Prefix    string
+	Shard     func() string
+	Generator IDGenerator
+}
+
+// NewID returns a new prefixed id.
+func (g PrefixIDGenerator) NewID() (string, error) {
+	id, err := g.Generator.NewID()
+	if err != nil {
+		return "", err
+	}
+	if g.Shard != nil {
+		id = g.Shard() + "." + id
+	}
+	return g.Prefix + id, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if c, err := rand.Read(b); c != len(b) || err != nil {
+		return nil, fmt.Errorf("Could not successfully read from the system CSPRNG")
+	}
+	return b, nil
+}
+
+// SetIDGenerator replaces the generator of new session ids.
+func (manager *Manager) SetIDGenerator(gen IDGenerator) {
+	manager.idGenerator = gen
+}
+
+// sign appends the HMAC of id when sessionIDSignKey is configured.
+func (manager *Manager) sign(id string) string {
+	if manager.config.SessionIDSignKey == "" {
+		return id
+	}
+	return id + "." + base64.RawURLEncoding.EncodeToString(manager.signature(id))
+}
+
+// verify reports whether sid carries a valid signature, always true without sessionIDSignKey.
+func (manager *Manager) verify(sid string) bool {
+	if manager.config.SessionIDSignKey == "" {
+		return true
+	}
+	i := strings.LastIndexByte(sid, '.')
+	if i < 0 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sid[i+1:])
+	return err == nil && hmac.Equal(sig, manager.signature(sid[:i]))
+}
+
+func (manager *Manager) signature(id string) []byte {
+	mac := hmac.New(sha256.New, []byte(manager.config.SessionIDSignKey))
+	mac.Write([]byte(id))
+	return mac.Sum(nil)[:signatureLength]
+}
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// JanitorStats reports what the janitor of a Manager has done so far.
+type JanitorStats struct {
+	Runs          int64         // completed gc passes
+	Reclaimed     int64         // sessions removed over all passes
+	LastRun       time.Time     // start of the last pass
+	LastDuration  time.Duration // how long the last pass took
+	LastReclaimed int           // sessions removed by the last pass
+}
+
+// Janitor runs the gc of a session provider at jittered intervals until it is stopped.
+// The jitter keeps the instances of an application from collecting a shared store in lockstep.
+type Janitor struct {
+	provider ContextProvider
+	base     interface{}
+	interval time.Duration
+	jitter   float64 // fraction of interval each wait may deviate by
+
+	lock  sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+	stats JanitorStats
+}
+
+var (
+	janitorsLock sync.Mutex
+	janitors     = make(map[*Janitor]struct{})
+)
+
+// Janitor returns the janitor collecting the sessions of the manager.
+func (manager *Manager) Janitor() *Janitor {
+	return manager.janitor
+}
+
+// Start runs the gc every interval in its own goroutine until Stop is called.
+// Starting a running janitor does nothing.
+func (j *Janitor) Start() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.stop != nil {
+		return
+	}
+	if j.interval <= 0 {
+		SLogger.Println("session janitor not started, gclifetime is not set")
+		return
+	}
+	j.stop, j.done = make(chan struct{}), make(chan struct{})
+	go j.loop(j.stop, j.done)
+
+	janitorsLock.Lock()
+	janitors[j] = struct{}{}
+	janitorsLock.Unlock()
+}
+
+// Stop ends the gc loop and waits for a running pass to finish.
+// Stopping a stopped janitor does nothing.
+func (j *Janitor) Stop() {
+	j.lock.Lock()
+	stop, done := j.stop, j.done
+	j.stop, j.done = nil, nil
+	j.lock.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+
+	janitorsLock.Lock()
+	delete(janitors, j)
+	janitorsLock.Unlock()
+}
+
+// Stats returns a copy of the janitor statistics.
+func (j *Janitor) Stats() JanitorStats {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.stats
+}
+
+// Run collects the expired sessions once and returns how many were reclaimed.
+// Providers that are not a GCCounter are counted by the drop of SessionAll,
+// which sessions created during the pass can hide.
+func (j *Janitor) Run() int {
+	start := time.Now()
+	reclaimed := 0
+	if counter, ok := j.base.(GCCounter); ok {
+		reclaimed = counter.SessionGCCount()
+	} else {
+		before := j.provider.SessionAll()
+		j.provider.SessionGC()
+		if after := j.provider.SessionAll(); after < before {
+			reclaimed = before - after
+		}
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.stats.Runs++
+	j.stats.Reclaimed += int64(reclaimed)
+	j.stats.LastRun = start
+	j.stats.LastDuration = time.Since(start)
+	j.stats.LastReclaimed = reclaimed
+	return reclaimed
+}
+
+func (j *Janitor) loop(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		timer := time.NewTimer(j.next())
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			j.Run()
+		}
+	}
+}
+
+// next returns the interval moved by up to jitter in either direction.
+func (j *Janitor) next() time.Duration {
+	if j.jitter <= 0 {
+		return j.interval
+	}
+	return j.interval + time.Duration((rand.Float64()*2-1)*j.jitter*float64(j.interval))
+}
+
+// StopJanitors stops every running janitor, for use on application shutdown.
+func StopJanitors() {
+	janitorsLock.Lock()
+	running := make([]*Janitor, 0, len(janitors))
+	for j := range janitors {
+		running = append(running, j)
+	}
+	janitorsLock.Unlock()
+	for _, j := range running {
+		j.Stop()
+	}
+}
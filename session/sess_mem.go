@@ -1,27 +1,49 @@
 package session
+
 import (
 	"container/list"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var memdep = &MemProvider{list: list.New(), sessions: make(map[string]*list.Element)}
+// defaultMemShards is the number of shards of the memory provider
+// when the providerConfig does not set one.
+const defaultMemShards = 16
+
+var memdep = newMemProvider(defaultMemShards)
 
 // MemSessionStore memory session store.
 // it saved sessions in a map in memory.
 type MemSessionStore struct {
-	sid          string 						     // session id
-	timeAccessed time.Time		              // last access time
+	sid          string                      // session id
+	timeCreated  time.Time                   // creation time
+	timeAccessed time.Time                   // last access time
 	value        map[interface{}]interface{} // session store
-	lock sync.RWMutex
+	dirty        bool                        // modified since the last release
+	size         int                         // approximate size of value, only tracked with a size limit
+	held         bool                        // held by the provider, its size counts towards maxMemory
+	version      uint64                      // bumped by every compare-and-swap of VersionedMemProvider
+	pder         *MemProvider
+	lock         sync.RWMutex
 }
 
 // Set value to memory session
+// It returns a *QuotaError and leaves the session unchanged if the value
+// would exceed the maxKeys, maxSessionSize or maxMemory of the provider.
 func (st *MemSessionStore) Set(key, value interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
+	if err := st.grow(key, value); err != nil {
+		return err
+	}
 	st.value[key] = value
+	st.dirty = true
 	return nil
 }
 
@@ -39,7 +61,13 @@ func (st *MemSessionStore) Get(key interface{}) interface{} {
 func (st *MemSessionStore) Delete(key interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
-	delete(st.value, key)
+	if old, ok := st.value[key]; ok {
+		if st.pder.sized() {
+			st.resize(-approxSize(key) - approxSize(old))
+		}
+		delete(st.value, key)
+		st.dirty = true
+	}
 	return nil
 }
 
@@ -47,15 +75,488 @@ func (st *MemSessionStore) Delete(key interface{}) error {
 func (st *MemSessionStore) Flush() error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
+	if len(st.value) > 0 {
+		st.dirty = true
+	}
+	st.resize(-st.size)
 	st.value = make(map[interface{}]interface{})
 	return nil
 }
 
+// grow checks that value fits under key within the limits of the provider and
+// accounts for its size. The caller must hold st.lock.
+func (st *MemSessionStore) grow(key, value interface{}) error {
+	pder := st.pder
+	old, exists := st.value[key]
+	if !exists && pder.maxKeys > 0 && len(st.value) >= pder.maxKeys {
+		return &QuotaError{Limit: "maxKeys", Max: int64(pder.maxKeys), Value: int64(len(st.value) + 1)}
+	}
+	if !pder.sized() {
+		return nil
+	}
+	delta := approxSize(key) + approxSize(value)
+	if exists {
+		delta -= approxSize(key) + approxSize(old)
+	}
+	if pder.maxSessionSize > 0 && delta > 0 && st.size+delta > pder.maxSessionSize {
+		return &QuotaError{Limit: "maxSessionSize", Max: int64(pder.maxSessionSize), Value: int64(st.size + delta)}
+	}
+	return st.reserve(delta)
+}
+
+// reserve accounts for delta more bytes in st, unless they would take the
+// provider over maxMemory. The caller must hold st.lock.
+func (st *MemSessionStore) reserve(delta int) error {
+	pder := st.pder
+	if st.held && delta > 0 && pder.maxMemory > 0 {
+		if used := atomic.AddInt64(&pder.used, int64(delta)); used > pder.maxMemory {
+			atomic.AddInt64(&pder.used, -int64(delta))
+			return &QuotaError{Limit: "maxMemory", Max: pder.maxMemory, Value: used}
+		}
+		st.size += delta
+		return nil
+	}
+	st.resize(delta)
+	return nil
+}
+
+// replace swaps all values of st for values within the limits of the provider.
+// The caller must hold st.lock.
+func (st *MemSessionStore) replace(values map[interface{}]interface{}) error {
+	pder := st.pder
+	if pder.maxKeys > 0 && len(values) > pder.maxKeys {
+		return &QuotaError{Limit: "maxKeys", Max: int64(pder.maxKeys), Value: int64(len(values))}
+	}
+	if pder.sized() {
+		size := valuesSize(values)
+		if pder.maxSessionSize > 0 && size > pder.maxSessionSize {
+			return &QuotaError{Limit: "maxSessionSize", Max: int64(pder.maxSessionSize), Value: int64(size)}
+		}
+		if err := st.reserve(size - st.size); err != nil {
+			return err
+		}
+	}
+	st.value = copyValues(values)
+	return nil
+}
+
+// resize changes the tracked size of st by delta. The caller must hold st.lock.
+func (st *MemSessionStore) resize(delta int) {
+	st.size += delta
+	if st.held {
+		atomic.AddInt64(&st.pder.used, int64(delta))
+	}
+}
+
 // SessionID get this id of memory session store
 func (st *MemSessionStore) SessionID() string {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
 	return st.sid
 }
 
-// SessionRelease Implement method, no used.
-func (st *MemSessionStore) SesionRelease(w http.ResponseWriter) {
+// IsDirty reports whether the session was modified since it was last released.
+func (st *MemSessionStore) IsDirty() bool {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.dirty
+}
+
+// IdleExpiry returns when the session expires if it is not accessed again.
+func (st *MemSessionStore) IdleExpiry() time.Time {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.timeAccessed.Add(time.Duration(st.pder.maxlifetime) * time.Second)
+}
+
+// AbsoluteExpiry returns when the session expires regardless of activity,
+// or the zero time when the provider has no absolute lifetime.
+func (st *MemSessionStore) AbsoluteExpiry() time.Time {
+	if st.pder.absoluteLifetime <= 0 {
+		return time.Time{}
+	}
+	return st.timeCreated.Add(time.Duration(st.pder.absoluteLifetime) * time.Second)
+}
+
+// ExpiresAt returns the earlier of IdleExpiry and AbsoluteExpiry.
+func (st *MemSessionStore) ExpiresAt() time.Time {
+	idle, absolute := st.IdleExpiry(), st.AbsoluteExpiry()
+	if !absolute.IsZero() && absolute.Before(idle) {
+		return absolute
+	}
+	return idle
+}
+
+// Snapshot returns a copy of the session values.
+func (st *MemSessionStore) Snapshot() map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return copyValues(st.value)
+}
+
+// SessionRelease clears the dirty flag and refreshes the access time.
+// Values already live in memory, so there is nothing else to persist.
+func (st *MemSessionStore) SessionRelease(w http.ResponseWriter) {
+	st.lock.Lock()
+	st.dirty = false
+	sid := st.sid
+	st.lock.Unlock()
+	st.pder.SessionTouch(sid)
+}
+
+// memProviderConfig is the optional JSON providerConfig of the memory provider,
+// e.g. {"absoluteLifetime":86400,"shards":32,"maxSessions":100000,"maxKeys":64,"maxSessionSize":65536,"maxMemory":268435456}
+// Sizes are approximate encoded sizes in bytes.
+type memProviderConfig struct {
+	AbsoluteLifetime int64 `json:"absoluteLifetime"` // max age in seconds regardless of activity, 0 disables it
+	Shards           int   `json:"shards"`           // independently locked shards, default 16
+	MaxSessions      int   `json:"maxSessions"`      // sessions of all shards, least recently used ones are evicted above it, 0 is unlimited
+	MaxKeys          int   `json:"maxKeys"`          // keys a session may hold, 0 is unlimited
+	MaxSessionSize   int   `json:"maxSessionSize"`   // size of the values of a session, 0 is unlimited
+	MaxMemory        int64 `json:"maxMemory"`        // size of the values of all sessions, 0 is unlimited
+}
+
+// memShard holds the sessions whose id hashes to it, with its own lock and LRU list.
+type memShard struct {
+	index    int                      // position in MemProvider.shards, orders locking
+	lock     sync.RWMutex             // locker
+	sessions map[string]*list.Element // map in memory
+	list     *list.List               // for gc and eviction, most recently accessed first
+}
+
+// MemProvider Implement the provider interface.
+// Sessions are spread over shards by the hash of their id so that requests
+// for different sessions rarely contend on the same lock.
+type MemProvider struct {
+	used             int64 // size of the values of all held sessions, accessed atomically
+	count            int64 // sessions held in all shards, accessed atomically
+	shards           []*memShard
+	maxlifetime      int64 // idle timeout in seconds
+	absoluteLifetime int64 // maximum age in seconds, 0 is unlimited
+	maxSessions      int64 // maximum sessions in all shards, 0 is unlimited
+	maxKeys          int   // maximum keys per session, 0 is unlimited
+	maxSessionSize   int   // maximum size per session, 0 is unlimited
+	maxMemory        int64 // maximum size of all sessions, 0 is unlimited
+	savePath         string
+	onExpire         func(session Store)
+}
+
+func newMemProvider(shards int) *MemProvider {
+	pder := &MemProvider{shards: make([]*memShard, shards)}
+	for i := range pder.shards {
+		pder.shards[i] = &memShard{index: i, sessions: make(map[string]*list.Element), list: list.New()}
+	}
+	return pder
+}
+
+// SessionInit init memory session.
+// Changing the number of shards drops the sessions already held by the provider.
+func (pder *MemProvider) SessionInit(maxlifetime int64, savePath string) error {
+	pder.maxlifetime = maxlifetime
+	pder.savePath = savePath
+	if !strings.HasPrefix(strings.TrimSpace(savePath), "{") {
+		return nil
+	}
+	cf := &memProviderConfig{}
+	if err := json.Unmarshal([]byte(savePath), cf); err != nil {
+		return err
+	}
+	pder.absoluteLifetime = cf.AbsoluteLifetime
+	if cf.Shards > 0 && cf.Shards != len(pder.shards) {
+		pder.shards = newMemProvider(cf.Shards).shards
+		atomic.StoreInt64(&pder.used, 0)
+		atomic.StoreInt64(&pder.count, 0)
+	}
+	if cf.MaxKeys < 0 || cf.MaxSessionSize < 0 || cf.MaxMemory < 0 {
+		return errors.New("session: memory maxKeys, maxSessionSize and maxMemory must not be negative")
+	}
+	pder.maxKeys = cf.MaxKeys
+	pder.maxSessionSize = cf.MaxSessionSize
+	pder.maxMemory = cf.MaxMemory
+	pder.maxSessions = 0
+	if cf.MaxSessions > 0 {
+		pder.maxSessions = int64(cf.MaxSessions)
+	}
+	return nil
+}
+
+// SessionRead get memory session store by sid.
+// An expired session is dropped and an empty one is returned in its place.
+func (pder *MemProvider) SessionRead(sid string) (Store, error) {
+	shard := pder.shard(sid)
+	shard.lock.RLock()
+	if element, ok := shard.sessions[sid]; ok && !pder.expired(element.Value.(*MemSessionStore), time.Now()) {
+		shard.lock.RUnlock()
+		return element.Value.(*MemSessionStore), nil
+	}
+	shard.lock.RUnlock()
+	var dropped []*MemSessionStore
+	defer pder.notifyExpired(&dropped)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	// another request may have created or dropped it while the lock was released
+	if element, ok := shard.sessions[sid]; ok {
+		st := element.Value.(*MemSessionStore)
+		if !pder.expired(st, time.Now()) {
+			return st, nil
+		}
+		shard.remove(sid, element)
+		dropped = append(dropped, st)
+	}
+	return pder.create(shard, sid, &dropped), nil
+}
+
+// SessionExist check session store exist in memory session by sid.
+// Expired sessions are reported as missing even if SessionGC has not run yet.
+func (pder *MemProvider) SessionExist(sid string) bool {
+	shard := pder.shard(sid)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	if element, ok := shard.sessions[sid]; ok {
+		return !pder.expired(element.Value.(*MemSessionStore), time.Now())
+	}
+	return false
+}
+
+// SessionRegenerate generate new sid for session store in memory session
+func (pder *MemProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	from, to := pder.shard(oldsid), pder.shard(sid)
+	var dropped []*MemSessionStore
+	defer pder.notifyExpired(&dropped)
+	unlock := lockShards(from, to)
+	defer unlock()
+	if element, ok := from.sessions[oldsid]; ok {
+		st := element.Value.(*MemSessionStore)
+		from.remove(oldsid, element)
+		if !pder.expired(st, time.Now()) {
+			pder.evict(to, &dropped)
+			st.lock.Lock()
+			st.sid = sid
+			st.timeAccessed = time.Now()
+			st.held = true
+			atomic.AddInt64(&pder.used, int64(st.size))
+			st.lock.Unlock()
+			to.sessions[sid] = to.list.PushFront(st)
+			atomic.AddInt64(&pder.count, 1)
+			return st, nil
+		}
+		dropped = append(dropped, st)
+	}
+	return pder.create(to, sid, &dropped), nil
+}
+
+// SessionDestroy delete session store in memory session by id
+func (pder *MemProvider) SessionDestroy(sid string) error {
+	shard := pder.shard(sid)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if element, ok := shard.sessions[sid]; ok {
+		shard.remove(sid, element)
+	}
+	return nil
+}
+
+// SessionGC clean expired session stores in memory session
+func (pder *MemProvider) SessionGC() {
+	pder.SessionGCCount()
+}
+
+// SessionGCCount cleans expired session stores and returns how many were removed.
+func (pder *MemProvider) SessionGCCount() int {
+	reclaimed := 0
+	for _, shard := range pder.shards {
+		reclaimed += pder.gcShard(shard, time.Now())
+	}
+	return reclaimed
+}
+
+// gcShard removes the expired sessions of shard and returns how many there were.
+func (pder *MemProvider) gcShard(shard *memShard, now time.Time) int {
+	var dropped []*MemSessionStore
+	defer pder.notifyExpired(&dropped)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	for element := shard.list.Back(); element != nil; {
+		prev := element.Prev()
+		st := element.Value.(*MemSessionStore)
+		if pder.expired(st, now) {
+			shard.remove(st.sid, element)
+			dropped = append(dropped, st)
+		} else if pder.absoluteLifetime <= 0 {
+			// the list is ordered by access time, everything in front is younger
+			break
+		}
+		element = prev
+	}
+	return len(dropped)
+}
+
+// SessionAll get count number of memory session
+func (pder *MemProvider) SessionAll() int {
+	count := 0
+	for _, shard := range pder.shards {
+		shard.lock.RLock()
+		count += shard.list.Len()
+		shard.lock.RUnlock()
+	}
+	return count
+}
+
+// SessionTouch refreshes the access time of the session without touching its values.
+func (pder *MemProvider) SessionTouch(sid string) error {
+	shard := pder.shard(sid)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if element, ok := shard.sessions[sid]; ok {
+		st := element.Value.(*MemSessionStore)
+		st.lock.Lock()
+		st.timeAccessed = time.Now()
+		st.lock.Unlock()
+		shard.list.MoveToFront(element)
+	}
+	return nil
+}
+
+// SessionIterate calls fn for every live session until fn returns false.
+// No lock is held while fn runs.
+func (pder *MemProvider) SessionIterate(fn func(info SessionInfo, session Store) bool) error {
+	for _, shard := range pder.shards {
+		now := time.Now()
+		shard.lock.RLock()
+		stores := make([]*MemSessionStore, 0, shard.list.Len())
+		for element := shard.list.Front(); element != nil; element = element.Next() {
+			if st := element.Value.(*MemSessionStore); !pder.expired(st, now) {
+				stores = append(stores, st)
+			}
+		}
+		shard.lock.RUnlock()
+		for _, st := range stores {
+			if !fn(st.info(), st) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// info returns the metadata of st.
+func (st *MemSessionStore) info() SessionInfo {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return SessionInfo{
+		SID:        st.sid,
+		Created:    st.timeCreated,
+		LastAccess: st.timeAccessed,
+		Size:       valuesSize(st.value),
+	}
+}
+
+// shard returns the shard responsible for sid.
+func (pder *MemProvider) shard(sid string) *memShard {
+	h := fnv.New32a()
+	h.Write([]byte(sid))
+	return pder.shards[h.Sum32()%uint32(len(pder.shards))]
+}
+
+// expired reports whether st passed its idle timeout or its absolute lifetime.
+// the caller must hold the lock of the shard of st.
+func (pder *MemProvider) expired(st *MemSessionStore, now time.Time) bool {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if now.Sub(st.timeAccessed) > time.Duration(pder.maxlifetime)*time.Second {
+		return true
+	}
+	return pder.absoluteLifetime > 0 && now.Sub(st.timeCreated) > time.Duration(pder.absoluteLifetime)*time.Second
+}
+
+// create adds an empty session with sid to shard, the caller must hold shard.lock.
+// Sessions evicted to make room are appended to dropped.
+func (pder *MemProvider) create(shard *memShard, sid string, dropped *[]*MemSessionStore) *MemSessionStore {
+	pder.evict(shard, dropped)
+	now := time.Now()
+	newsess := &MemSessionStore{sid: sid, timeCreated: now, timeAccessed: now, value: make(map[interface{}]interface{}), held: true, pder: pder}
+	shard.sessions[sid] = shard.list.PushFront(newsess)
+	atomic.AddInt64(&pder.count, 1)
+	return newsess
+}
+
+// evict drops the least recently used sessions of shard while all shards
+// together hold maxSessions or more, and appends them to dropped. The caller
+// must hold shard.lock. Only the shard being filled is evicted from, so when
+// it is empty the new session is admitted above the limit, by at most one
+// session per concurrent writer, until the next insert into a fuller shard.
+func (pder *MemProvider) evict(shard *memShard, dropped *[]*MemSessionStore) {
+	if pder.maxSessions <= 0 {
+		return
+	}
+	for shard.list.Len() > 0 && atomic.LoadInt64(&pder.count) >= pder.maxSessions {
+		element := shard.list.Back()
+		st := element.Value.(*MemSessionStore)
+		shard.remove(st.sid, element)
+		*dropped = append(*dropped, st)
+	}
+}
+
+// SetExpiryHandler sets fn to be called with every session the provider drops
+// because it expired or was evicted. The last handler set wins.
+func (pder *MemProvider) SetExpiryHandler(fn func(session Store)) {
+	pder.onExpire = fn
+}
+
+// notifyExpired passes the dropped sessions to the expiry handler.
+// It must be called without holding any shard lock.
+func (pder *MemProvider) notifyExpired(dropped *[]*MemSessionStore) {
+	if pder.onExpire == nil {
+		return
+	}
+	for _, st := range *dropped {
+		pder.onExpire(st)
+	}
+}
+
+// remove drops the session held by element, the caller must hold shard.lock.
+// Its size no longer counts towards maxMemory.
+func (shard *memShard) remove(sid string, element *list.Element) {
+	delete(shard.sessions, sid)
+	shard.list.Remove(element)
+	st := element.Value.(*MemSessionStore)
+	atomic.AddInt64(&st.pder.count, -1)
+	st.lock.Lock()
+	if st.held {
+		atomic.AddInt64(&st.pder.used, -int64(st.size))
+		st.held = false
+	}
+	st.lock.Unlock()
+}
+
+// sized reports whether the provider has a size limit and tracks the size of sessions.
+func (pder *MemProvider) sized() bool {
+	return pder.maxSessionSize > 0 || pder.maxMemory > 0
+}
+
+// MemoryUsed returns the approximate size of the values of all sessions,
+// it is only tracked when maxSessionSize or maxMemory is set.
+func (pder *MemProvider) MemoryUsed() int64 {
+	return atomic.LoadInt64(&pder.used)
+}
+
+// lockShards write-locks both shards in a fixed order and returns the unlock function.
+func lockShards(a, b *memShard) func() {
+	if a == b {
+		a.lock.Lock()
+		return a.lock.Unlock
+	}
+	if a.index > b.index {
+		a, b = b, a
+	}
+	a.lock.Lock()
+	b.lock.Lock()
+	return func() {
+		b.lock.Unlock()
+		a.lock.Unlock()
+	}
+}
+
+func init() {
+	Register("memory", memdep)
 }
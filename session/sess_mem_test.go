@@ -0,0 +1,99 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemProviderMaxSessionsIsGlobal(t *testing.T) {
+	pder := newMemProvider(defaultMemShards)
+	if err := pder.SessionInit(3600, `{"maxSessions":8}`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		pder.SessionRead("sid" + strconv.Itoa(i))
+	}
+	if n := pder.SessionAll(); n != 8 {
+		t.Fatalf("got %d sessions below the limit, want 8", n)
+	}
+	for i := 0; i < 8; i++ {
+		if !pder.SessionExist("sid" + strconv.Itoa(i)) {
+			t.Fatalf("sid%d was evicted before the limit was reached", i)
+		}
+	}
+	for i := 8; i < 64; i++ {
+		pder.SessionRead("sid" + strconv.Itoa(i))
+	}
+	// a new session lands in an empty shard at most once per shard
+	if n := pder.SessionAll(); n > 8+defaultMemShards {
+		t.Fatalf("got %d sessions, want at most %d", n, 8+defaultMemShards)
+	}
+}
+
+func TestMemProviderCountFollowsRemoval(t *testing.T) {
+	pder := newMemProvider(4)
+	pder.SessionInit(3600, "")
+	pder.SessionRead("a")
+	pder.SessionRead("b")
+	pder.SessionRegenerate("a", "c")
+	pder.SessionDestroy("b")
+	if n := atomic.LoadInt64(&pder.count); n != 1 || pder.SessionAll() != 1 {
+		t.Fatalf("count = %d, SessionAll = %d, want 1", n, pder.SessionAll())
+	}
+}
+
+// benchmarkMemProvider reads, writes and releases sessions from parallel
+// goroutines, each one starting at a different session.
+func benchmarkMemProvider(b *testing.B, shards, sessions int) {
+	pder := newMemProvider(shards)
+	if err := pder.SessionInit(3600, ""); err != nil {
+		b.Fatal(err)
+	}
+	sids := make([]string, sessions)
+	for i := range sids {
+		sids[i] = fmt.Sprintf("%032x", i)
+		pder.SessionRead(sids[i])
+	}
+	var seed int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&seed, 7919))
+		for pb.Next() {
+			st, err := pder.SessionRead(sids[i%len(sids)])
+			if err != nil {
+				b.Fatal(err)
+			}
+			if i%4 == 0 {
+				st.Set("n", i)
+			} else {
+				st.Get("n")
+			}
+			st.SessionRelease(nil)
+			i++
+		}
+	})
+}
+
+func BenchmarkMemProviderParallel1Shard(b *testing.B)   { benchmarkMemProvider(b, 1, 10000) }
+func BenchmarkMemProviderParallel16Shards(b *testing.B) { benchmarkMemProvider(b, 16, 10000) }
+func BenchmarkMemProviderParallel64Shards(b *testing.B) { benchmarkMemProvider(b, 64, 10000) }
+
+// BenchmarkMemProviderParallelEvict creates a new session on every read
+// while the provider is at its maxSessions limit.
+func BenchmarkMemProviderParallelEvict(b *testing.B) {
+	pder := newMemProvider(defaultMemShards)
+	if err := pder.SessionInit(3600, `{"maxSessions":1000}`); err != nil {
+		b.Fatal(err)
+	}
+	var next int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			pder.SessionRead(strconv.FormatInt(atomic.AddInt64(&next, 1), 36))
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// VersionedMemProvider keeps sessions in memory like MemProvider, but hands
+// every request its own copy of the values as a VersionedStore, committed back
+// with compare-and-swap. It takes the providerConfig of MemProvider and is the
+// reference VersionedProvider.
+type VersionedMemProvider struct {
+	*MemProvider
+}
+
+var versionedMemdep = &VersionedMemProvider{newMemProvider(defaultMemShards)}
+
+// SessionRead returns a VersionedStore holding a copy of the values of sid,
+// creating the session when it does not exist.
+func (pder *VersionedMemProvider) SessionRead(sid string) (Store, error) {
+	store, err := pder.MemProvider.SessionRead(sid)
+	if err != nil {
+		return nil, err
+	}
+	return pder.versioned(store.(*MemSessionStore)), nil
+}
+
+// SessionRegenerate moves the session to sid and returns a VersionedStore of it.
+func (pder *VersionedMemProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	store, err := pder.MemProvider.SessionRegenerate(oldsid, sid)
+	if err != nil {
+		return nil, err
+	}
+	return pder.versioned(store.(*MemSessionStore)), nil
+}
+
+func (pder *VersionedMemProvider) versioned(st *MemSessionStore) *VersionedStore {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return NewVersionedStore(pder, st.sid, copyValues(st.value), st.version)
+}
+
+// SessionLoad returns a copy of the values of sid and their version.
+// It returns ErrSessionConflict when the session was destroyed, regenerated
+// or dropped since it was read, a write must not bring it back.
+func (pder *VersionedMemProvider) SessionLoad(ctx context.Context, sid string) (map[interface{}]interface{}, uint64, error) {
+	shard := pder.shard(sid)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	element, ok := shard.sessions[sid]
+	if !ok || pder.expired(element.Value.(*MemSessionStore), time.Now()) {
+		return nil, 0, ErrSessionConflict
+	}
+	st := element.Value.(*MemSessionStore)
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return copyValues(st.value), st.version, nil
+}
+
+// SessionCompareAndSwap replaces the values of sid if they are still at version.
+// A session that is gone is a conflict too, see SessionLoad.
+// It returns a *QuotaError when values exceed the limits of the provider.
+func (pder *VersionedMemProvider) SessionCompareAndSwap(ctx context.Context, sid string, version uint64, values map[interface{}]interface{}) (uint64, error) {
+	shard := pder.shard(sid)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	element, ok := shard.sessions[sid]
+	if !ok || pder.expired(element.Value.(*MemSessionStore), time.Now()) {
+		return 0, ErrSessionConflict
+	}
+	st := element.Value.(*MemSessionStore)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.version != version {
+		return 0, ErrSessionConflict
+	}
+	if err := st.replace(values); err != nil {
+		return 0, err
+	}
+	st.version++
+	st.timeAccessed = time.Now()
+	shard.list.MoveToFront(element)
+	return st.version, nil
+}
+
+func init() {
+	Register("memory-versioned", versionedMemdep)
+}
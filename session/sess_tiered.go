@@ -0,0 +1,386 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaults of the tiered provider when its providerConfig leaves them out
+const (
+	defaultTieredStaleness  = 10   // seconds
+	defaultTieredFlushDelay = 1000 // milliseconds
+)
+
+// tieredWriteLocks is the number of locks the writes of the tiered provider are spread over by sid.
+const tieredWriteLocks = 64
+
+var tiereddep = &TieredProvider{}
+
+// tieredKey is the key a cache entry holds the backend store under.
+// It is unexported, so no application key can collide with it.
+type tieredKey struct{}
+
+// tieredProviderConfig is the JSON providerConfig of the tiered provider,
+// e.g. {"backend":"redis","backendConfig":"127.0.0.1:6379","staleness":10,"flushDelay":1000}
+type tieredProviderConfig struct {
+	Backend       string `json:"backend"`       // name of the registered provider the sessions are persisted in
+	BackendConfig string `json:"backendConfig"` // providerConfig passed to the backend
+	Staleness     int64  `json:"staleness"`     // seconds a cached session is served before it is read again, default 10
+	FlushDelay    int64  `json:"flushDelay"`    // milliseconds a released session waits before it is written, default 1000, negative writes at once
+	Shards        int    `json:"shards"`        // shards of the cache, default 16
+	MaxSessions   int    `json:"maxSessions"`   // least recently read sessions are evicted from the cache above it, 0 is unlimited
+}
+
+// TieredProvider keeps the sessions of a backend provider in a memory cache.
+// Reads are served from the cache for up to staleness seconds after the session
+// was read from the backend. Released sessions are written to the backend after
+// flushDelay, so a session released by several requests in a row is written once.
+// Destroying or regenerating a session drops it from the cache at once, and
+// its old id is never written to the backend again within the session lifetime,
+// so neither a pending write nor a request still holding the session can bring it back.
+//
+// Sessions of a backend returning VersionedStores are copied for every request
+// and committed at release, compare-and-swap can't be deferred and merged.
+//
+// Other instances of the application see a change once it is written and their
+// cached copy is stale. The backend must not depend on the ResponseWriter passed
+// to SessionRelease, the cookie provider can't be used.
+type TieredProvider struct {
+	backend    ContextProvider
+	cache      *MemProvider
+	flushDelay time.Duration
+	lifetime   time.Duration // session lifetime, how long a destroyed sid is remembered
+
+	fill    sync.Mutex                   // orders filling the cache with a backend store
+	writes  [tieredWriteLocks]sync.Mutex // by sid, orders writes against destroy and regenerate
+	lock    sync.Mutex                   // guards pending, timer and gone
+	pending map[string]Store
+	timer   *time.Timer
+	gone    map[string]time.Time // destroyed and regenerated sids, with when they went
+}
+
+// TieredSessionStore is the Store of the tiered provider. It wraps the backend
+// store, which is shared by all requests reading the session while it is cached,
+// except for a VersionedStore, which every request gets its own copy of.
+type TieredSessionStore struct {
+	Store
+	pder *TieredProvider
+}
+
+// SessionRelease schedules the session to be written to the backend,
+// a versioned session is committed at once.
+func (st *TieredSessionStore) SessionRelease(w http.ResponseWriter) {
+	if vs, ok := st.Store.(*VersionedStore); ok {
+		if err := st.pder.commit(context.Background(), vs); err != nil {
+			SLogger.Println("session release:", err)
+		}
+		return
+	}
+	st.pder.schedule(st.Store)
+}
+
+// Commit writes the session to the backend now instead of after flushDelay.
+// A versioned session returns ErrSessionConflict when it was changed by
+// another request, or was destroyed or regenerated since it was read.
+func (st *TieredSessionStore) Commit(ctx context.Context) error {
+	if vs, ok := st.Store.(*VersionedStore); ok {
+		return st.pder.commit(ctx, vs)
+	}
+	sid := st.SessionID()
+	st.pder.lock.Lock()
+	delete(st.pder.pending, sid)
+	st.pder.lock.Unlock()
+	st.pder.write(sid, st.Store)
+	return nil
+}
+
+// IsDirty reports whether the backend store has changes, if it tracks them.
+func (st *TieredSessionStore) IsDirty() bool {
+	if ds, ok := st.Store.(DirtyStore); ok {
+		return ds.IsDirty()
+	}
+	return true
+}
+
+// SessionInit init the tiered provider and its backend.
+// Sessions cached or pending from an earlier init are written and dropped.
+func (pder *TieredProvider) SessionInit(maxlifetime int64, config string) error {
+	cf := &tieredProviderConfig{}
+	if err := json.Unmarshal([]byte(config), cf); err != nil {
+		return err
+	}
+	if cf.Backend == "" {
+		return errors.New("session: tiered provider needs a backend")
+	}
+	if cf.Staleness == 0 {
+		cf.Staleness = defaultTieredStaleness
+	}
+	if cf.Staleness < 0 {
+		return errors.New("session: tiered staleness must not be negative")
+	}
+	if cf.FlushDelay == 0 {
+		cf.FlushDelay = defaultTieredFlushDelay
+	}
+
+	var backend ContextProvider
+	if p, ok := provides[cf.Backend]; ok {
+		backend = WrapProvider(p)
+	} else if p, ok := contextProvides[cf.Backend]; ok && p != ContextProvider(pder) {
+		backend = p
+	} else {
+		return fmt.Errorf("session: unknown tiered backend %q (forgotten import?)", cf.Backend)
+	}
+	if err := backend.SessionInit(maxlifetime, cf.BackendConfig); err != nil {
+		return err
+	}
+
+	shards := cf.Shards
+	if shards <= 0 {
+		shards = defaultMemShards
+	}
+	cache := newMemProvider(shards)
+	// the cache is never touched, so its idle timeout is the time since a session was read
+	cacheConfig, _ := json.Marshal(memProviderConfig{MaxSessions: cf.MaxSessions})
+	if err := cache.SessionInit(cf.Staleness, string(cacheConfig)); err != nil {
+		return err
+	}
+
+	pder.Flush()
+	pder.backend = backend
+	pder.cache = cache
+	pder.flushDelay = time.Duration(cf.FlushDelay) * time.Millisecond
+	pder.lifetime = time.Duration(maxlifetime) * time.Second
+	return nil
+}
+
+// SessionRead returns the cached session of sid, or reads it from the backend
+// when it is not cached or stale.
+func (pder *TieredProvider) SessionRead(ctx context.Context, sid string) (Store, error) {
+	if st := pder.cached(sid); st != nil {
+		return pder.session(st), nil
+	}
+	// a stale copy may still have writes the backend has not seen
+	pder.flush(sid)
+	st, err := pder.backend.SessionRead(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	return pder.session(pder.store(sid, st)), nil
+}
+
+// SessionExist reports whether sid is cached or stored in the backend.
+func (pder *TieredProvider) SessionExist(ctx context.Context, sid string) (bool, error) {
+	if pder.cached(sid) != nil {
+		return true, nil
+	}
+	return pder.backend.SessionExist(ctx, sid)
+}
+
+// SessionRegenerate writes the session of oldsid, moves it to sid in the backend
+// and caches it under sid. Later writes for oldsid are dropped.
+func (pder *TieredProvider) SessionRegenerate(ctx context.Context, oldsid, sid string) (Store, error) {
+	mu := pder.writeLock(oldsid)
+	mu.Lock()
+	defer mu.Unlock()
+	pder.lock.Lock()
+	pending, ok := pder.pending[oldsid]
+	pder.lock.Unlock()
+	if ok {
+		pending.SessionRelease(nil)
+	}
+	pder.bury(oldsid)
+	pder.cache.SessionDestroy(oldsid)
+	st, err := pder.backend.SessionRegenerate(ctx, oldsid, sid)
+	if err != nil {
+		return nil, err
+	}
+	return pder.session(pder.store(sid, st)), nil
+}
+
+// SessionDestroy drops sid from the cache and destroys it in the backend.
+// Writes still pending for sid are discarded, and so are later ones.
+func (pder *TieredProvider) SessionDestroy(ctx context.Context, sid string) error {
+	mu := pder.writeLock(sid)
+	mu.Lock()
+	defer mu.Unlock()
+	pder.bury(sid)
+	pder.cache.SessionDestroy(sid)
+	return pder.backend.SessionDestroy(ctx, sid)
+}
+
+// SessionAll returns the number of sessions in the backend.
+func (pder *TieredProvider) SessionAll() int {
+	return pder.backend.SessionAll()
+}
+
+// SessionGC writes pending sessions, drops stale cache entries, forgets the sids
+// destroyed longer than a session lifetime ago and runs the gc of the backend.
+func (pder *TieredProvider) SessionGC() {
+	pder.Flush()
+	pder.cache.SessionGC()
+	pder.lock.Lock()
+	for sid, at := range pder.gone {
+		if time.Since(at) > pder.lifetime {
+			delete(pder.gone, sid)
+		}
+	}
+	pder.lock.Unlock()
+	pder.backend.SessionGC()
+}
+
+// Flush writes every pending session to the backend.
+func (pder *TieredProvider) Flush() {
+	pder.lock.Lock()
+	pending := pder.pending
+	pder.pending = nil
+	if pder.timer != nil {
+		pder.timer.Stop()
+		pder.timer = nil
+	}
+	pder.lock.Unlock()
+	for sid, st := range pending {
+		pder.write(sid, st)
+	}
+}
+
+// cached returns the backend store cached for sid, or nil if there is no fresh one.
+func (pder *TieredProvider) cached(sid string) Store {
+	if !pder.cache.SessionExist(sid) {
+		return nil
+	}
+	entry, _ := pder.cache.SessionRead(sid)
+	st, _ := entry.Get(tieredKey{}).(Store)
+	return st
+}
+
+// session returns the store of a request for the backend store st.
+func (pder *TieredProvider) session(st Store) *TieredSessionStore {
+	if vs, ok := st.(*VersionedStore); ok {
+		st = vs.clone()
+	}
+	return &TieredSessionStore{Store: st, pder: pder}
+}
+
+// store caches st for sid and returns the store to use, which is the one
+// another request cached in the meantime if there is one.
+func (pder *TieredProvider) store(sid string, st Store) Store {
+	pder.fill.Lock()
+	defer pder.fill.Unlock()
+	entry, _ := pder.cache.SessionRead(sid)
+	if cached, ok := entry.Get(tieredKey{}).(Store); ok {
+		return cached
+	}
+	entry.Set(tieredKey{}, st)
+	return st
+}
+
+// schedule queues st to be written after flushDelay, or writes it at once without one.
+func (pder *TieredProvider) schedule(st Store) {
+	if pder.flushDelay <= 0 {
+		pder.write(st.SessionID(), st)
+		return
+	}
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if pder.pending == nil {
+		pder.pending = make(map[string]Store)
+	}
+	pder.pending[st.SessionID()] = st
+	if pder.timer == nil {
+		pder.timer = time.AfterFunc(pder.flushDelay, pder.Flush)
+	}
+}
+
+// flush writes sid to the backend now if it is pending.
+func (pder *TieredProvider) flush(sid string) {
+	pder.lock.Lock()
+	st, ok := pder.pending[sid]
+	delete(pder.pending, sid)
+	pder.lock.Unlock()
+	if ok {
+		pder.write(sid, st)
+	}
+}
+
+// write writes st to the backend unless sid was destroyed or regenerated.
+func (pder *TieredProvider) write(sid string, st Store) {
+	mu := pder.writeLock(sid)
+	mu.Lock()
+	defer mu.Unlock()
+	if !pder.buried(sid) {
+		st.SessionRelease(nil)
+	}
+}
+
+// commit writes a versioned session to the backend at once and caches the
+// committed values. It returns ErrSessionConflict when sid was destroyed or regenerated.
+func (pder *TieredProvider) commit(ctx context.Context, vs *VersionedStore) error {
+	sid := vs.SessionID()
+	mu := pder.writeLock(sid)
+	mu.Lock()
+	defer mu.Unlock()
+	if pder.buried(sid) {
+		return ErrSessionConflict
+	}
+	if !vs.IsDirty() {
+		vs.SessionRelease(nil)
+		return nil
+	}
+	if err := vs.Commit(ctx); err != nil {
+		return err
+	}
+	pder.recache(sid, vs)
+	return nil
+}
+
+// recache replaces the cached copy of a versioned session with vs, unless
+// the cache holds a newer version or none at all.
+func (pder *TieredProvider) recache(sid string, vs *VersionedStore) {
+	pder.fill.Lock()
+	defer pder.fill.Unlock()
+	if !pder.cache.SessionExist(sid) {
+		return
+	}
+	entry, _ := pder.cache.SessionRead(sid)
+	if cached, ok := entry.Get(tieredKey{}).(*VersionedStore); ok && cached.Version() >= vs.Version() {
+		return
+	}
+	entry.Set(tieredKey{}, vs.clone())
+}
+
+// bury drops the pending write of sid and keeps later ones from landing.
+// The caller must hold the write lock of sid.
+func (pder *TieredProvider) bury(sid string) {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	delete(pder.pending, sid)
+	if pder.gone == nil {
+		pder.gone = make(map[string]time.Time)
+	}
+	pder.gone[sid] = time.Now()
+}
+
+// buried reports whether sid was destroyed or regenerated.
+func (pder *TieredProvider) buried(sid string) bool {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	_, ok := pder.gone[sid]
+	return ok
+}
+
+// writeLock returns the lock ordering the writes of sid against its destroy and regenerate.
+func (pder *TieredProvider) writeLock(sid string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(sid))
+	return &pder.writes[h.Sum32()%tieredWriteLocks]
+}
+
+func init() {
+	RegisterContextProvider("tiered", tiereddep)
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// recordingProvider is a backend that keeps the sids written by SessionRelease.
+type recordingProvider struct {
+	lock    sync.Mutex
+	written map[string]bool
+}
+
+type recordingStore struct {
+	*MemSessionStore
+	pder *recordingProvider
+}
+
+func (st *recordingStore) SessionRelease(w http.ResponseWriter) {
+	st.pder.lock.Lock()
+	defer st.pder.lock.Unlock()
+	st.pder.written[st.SessionID()] = true
+}
+
+func (pder *recordingProvider) SessionInit(maxlifetime int64, config string) error {
+	pder.written = make(map[string]bool)
+	return nil
+}
+
+func (pder *recordingProvider) SessionRead(sid string) (Store, error) {
+	st := &MemSessionStore{sid: sid, value: make(map[interface{}]interface{}), pder: newMemProvider(1)}
+	return &recordingStore{MemSessionStore: st, pder: pder}, nil
+}
+
+func (pder *recordingProvider) SessionExist(sid string) bool {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	return pder.written[sid]
+}
+
+func (pder *recordingProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	pder.SessionDestroy(oldsid)
+	return pder.SessionRead(sid)
+}
+
+func (pder *recordingProvider) SessionDestroy(sid string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	delete(pder.written, sid)
+	return nil
+}
+
+func (pder *recordingProvider) SessionAll() int { return 0 }
+func (pder *recordingProvider) SessionGC()      {}
+
+func newTiered(t *testing.T, backend string) *TieredProvider {
+	pder := &TieredProvider{}
+	if err := pder.SessionInit(3600, `{"backend":"`+backend+`","flushDelay":60000}`); err != nil {
+		t.Fatal(err)
+	}
+	return pder
+}
+
+func TestTieredDestroyedSessionIsNotWrittenBack(t *testing.T) {
+	backend := &recordingProvider{}
+	Register("tiered-test-recording", backend)
+	pder := newTiered(t, "tiered-test-recording")
+	ctx := context.Background()
+
+	pending, _ := pder.SessionRead(ctx, "pending")
+	pending.Set("k", "v")
+	pending.SessionRelease(nil)
+	inFlight, _ := pder.SessionRead(ctx, "inflight")
+	regenerated, _ := pder.SessionRead(ctx, "old")
+	regenerated.Set("k", "v")
+
+	pder.SessionDestroy(ctx, "pending")
+	pder.SessionDestroy(ctx, "inflight")
+	pder.SessionRegenerate(ctx, "old", "new")
+	// requests still holding the sessions finish after they are gone
+	inFlight.Set("k", "v")
+	inFlight.SessionRelease(nil)
+	regenerated.SessionRelease(nil)
+	pder.Flush()
+
+	for _, sid := range []string{"pending", "inflight", "old"} {
+		if backend.SessionExist(sid) {
+			t.Errorf("%s was written back after it was gone", sid)
+		}
+	}
+}
+
+func TestTieredVersionedBackendSeesConflicts(t *testing.T) {
+	pder := newTiered(t, "memory-versioned")
+	ctx := context.Background()
+	a, _ := pder.SessionRead(ctx, "sid")
+	b, _ := pder.SessionRead(ctx, "sid")
+	b.(*TieredSessionStore).Store.(*VersionedStore).policy = ConflictError
+	a.Set("k", "a")
+	b.Set("k", "b")
+	if err := a.(Committer).Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(Committer).Commit(ctx); err != ErrSessionConflict {
+		t.Fatalf("got %v, want ErrSessionConflict", err)
+	}
+	c, _ := pder.SessionRead(ctx, "sid")
+	if v := c.Get("k"); v != "a" {
+		t.Fatalf("cached value is %v, want the committed a", v)
+	}
+}
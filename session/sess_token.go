@@ -0,0 +1,63 @@
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// defaultSessionTokenHeader is the response header a new bearer token is returned in
+// when sessionTokenHeader is not set.
+const defaultSessionTokenHeader = "X-Session-Token"
+
+// SessionToken is the JSON body WriteSessionToken answers with.
+type SessionToken struct {
+	Token     string `json:"token"`
+	TokenType string `json:"tokenType"`
+	ExpiresIn int64  `json:"expiresIn"` // seconds the session lives without being used
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header,
+// or "" when r does not carry one.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[len("Bearer "):])
+}
+
+// bearerSid returns the bearer token of r when it is the verified id of a
+// stored session, and "" when bearer tokens are disabled or the token is
+// something else, e.g. an OAuth or JWT credential meant for another layer.
+func (manager *Manager) bearerSid(r *http.Request) string {
+	if !manager.config.EnableSidInBearerToken {
+		return ""
+	}
+	sid := bearerToken(r)
+	if sid == "" || !manager.verify(sid) {
+		return ""
+	}
+	ctx, cancel := manager.withTimeout(r.Context())
+	defer cancel()
+	if exist, err := manager.provider.SessionExist(ctx, sid); err != nil || !exist {
+		return ""
+	}
+	return sid
+}
+
+// WriteSessionToken writes the id of session as a bearer token in a JSON body,
+// for API clients that log in with a request and keep the token themselves.
+//
+//	sess, _ := globalSessions.SessionStart(w, r)
+//	sess.Set("uid", uid)
+//	globalSessions.WriteSessionToken(w, sess)
+func (manager *Manager) WriteSessionToken(w http.ResponseWriter, session Store) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	return json.NewEncoder(w).Encode(SessionToken{
+		Token:     session.SessionID(),
+		TokenType: "Bearer",
+		ExpiresIn: manager.config.MaxLifetime,
+	})
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// QuotaError is returned when a change would take a session or a provider over one of its limits.
+type QuotaError struct {
+	Limit string // name of the exceeded limit in the providerConfig, e.g. "maxKeys"
+	Max   int64  // the configured limit
+	Value int64  // what the change would have reached
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("session: %s of %d exceeded, the change would reach %d", e.Limit, e.Max, e.Value)
+}
+
+// maxSizeDepth bounds how deep approxSize follows nested values,
+// which also keeps it from looping on cyclic data.
+const maxSizeDepth = 32
+
+// approxSize estimates how many bytes v takes once encoded. It is meant for
+// reporting and quotas, not as the exact size any provider writes.
+func approxSize(v interface{}) int {
+	return sizeOf(reflect.ValueOf(v), 0)
+}
+
+// valuesSize estimates the encoded size of a set of session values.
+func valuesSize(values map[interface{}]interface{}) int {
+	size := 0
+	for k, v := range values {
+		size += approxSize(k) + approxSize(v)
+	}
+	return size
+}
+
+func sizeOf(v reflect.Value, depth int) int {
+	if !v.IsValid() || depth > maxSizeDepth {
+		return 1
+	}
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Complex128:
+		return 16
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Len()
+		}
+		size := 0
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOf(v.Index(i), depth+1)
+		}
+		return size
+	case reflect.Map:
+		size := 0
+		for _, k := range v.MapKeys() {
+			size += sizeOf(k, depth+1) + sizeOf(v.MapIndex(k), depth+1)
+		}
+		return size
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOf(v.Field(i), depth+1)
+		}
+		return size
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 1
+		}
+		return sizeOf(v.Elem(), depth+1)
+	}
+	// int, int64, uint, uint64, float64, complex64 and the kinds that cannot be encoded
+	return 8
+}
@@ -0,0 +1,235 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrSessionConflict is returned when a session was changed by another request since it was read.
+var ErrSessionConflict = errors.New("session: concurrent modification")
+
+// conflict policies of ManagerConfig.ConflictPolicy
+const (
+	ConflictMerge = "merge" // reapply the keys changed by this request on the latest values and retry
+	ConflictError = "error" // give up and return ErrSessionConflict
+)
+
+// defaultConflictRetries is how often a merge is retried when conflictRetries is not set.
+const defaultConflictRetries = 3
+
+// VersionedProvider is implemented by persistent providers that keep a version
+// number with every session and can replace a session atomically.
+// Their SessionRead returns a store made by NewVersionedStore.
+type VersionedProvider interface {
+	// SessionLoad returns the stored values of sid and their version, 0 if sid is not stored yet.
+	SessionLoad(ctx context.Context, sid string) (map[interface{}]interface{}, uint64, error)
+	// SessionCompareAndSwap stores values for sid only if its stored version is still version,
+	// and returns the new version. Otherwise it returns ErrSessionConflict.
+	SessionCompareAndSwap(ctx context.Context, sid string, version uint64, values map[interface{}]interface{}) (uint64, error)
+}
+
+// change is a pending write to one key of a VersionedStore.
+type change struct {
+	value   interface{}
+	deleted bool
+}
+
+// VersionedStore is the Store of a VersionedProvider. It records the keys
+// changed during the request and writes them back with compare-and-swap,
+// so parallel requests on the same session cannot silently drop each other's writes.
+type VersionedStore struct {
+	lock     sync.RWMutex
+	provider VersionedProvider
+	sid      string
+	values   map[interface{}]interface{}
+	version  uint64
+	changes  map[interface{}]change
+	flushed  bool // Flush was called, the stored values are dropped before changes apply
+	policy   string
+	retries  int
+}
+
+// NewVersionedStore returns the store of sid holding values read at version.
+func NewVersionedStore(provider VersionedProvider, sid string, values map[interface{}]interface{}, version uint64) *VersionedStore {
+	if values == nil {
+		values = make(map[interface{}]interface{})
+	}
+	return &VersionedStore{
+		provider: provider,
+		sid:      sid,
+		values:   values,
+		version:  version,
+		changes:  make(map[interface{}]change),
+		policy:   ConflictMerge,
+		retries:  defaultConflictRetries,
+	}
+}
+
+// clone returns a copy of st without pending changes, with the same provider and conflict settings.
+func (st *VersionedStore) clone() *VersionedStore {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	c := NewVersionedStore(st.provider, st.sid, copyValues(st.values), st.version)
+	c.policy = st.policy
+	c.retries = st.retries
+	return c
+}
+
+// Set value to the session
+func (st *VersionedStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	st.changes[key] = change{value: value}
+	return nil
+}
+
+// Get value from the session by key
+func (st *VersionedStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.values[key]
+}
+
+// Delete value in the session by key
+func (st *VersionedStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	st.changes[key] = change{deleted: true}
+	return nil
+}
+
+// Flush clear all values in the session
+func (st *VersionedStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	st.changes = make(map[interface{}]change)
+	st.flushed = true
+	return nil
+}
+
+// SessionID get this id of the session
+func (st *VersionedStore) SessionID() string {
+	return st.sid
+}
+
+// Version returns the version the values were read or last committed at.
+func (st *VersionedStore) Version() uint64 {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.version
+}
+
+// IsDirty reports whether the session has changes that are not committed yet.
+func (st *VersionedStore) IsDirty() bool {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.flushed || len(st.changes) > 0
+}
+
+// Snapshot returns a copy of the session values.
+func (st *VersionedStore) Snapshot() map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return copyValues(st.values)
+}
+
+// Commit writes the changes made since the session was read.
+// When another request committed in between, the changed keys are merged into
+// the latest values and retried, or ErrSessionConflict is returned, depending
+// on the conflictPolicy of the Manager the session was started by.
+func (st *VersionedStore) Commit(ctx context.Context) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if !st.flushed && len(st.changes) == 0 {
+		return nil
+	}
+	version, err := st.provider.SessionCompareAndSwap(ctx, st.sid, st.version, st.values)
+	for retry := 0; err == ErrSessionConflict && st.policy == ConflictMerge && retry < st.retries; retry++ {
+		latest, latestVersion, lerr := st.provider.SessionLoad(ctx, st.sid)
+		if lerr != nil {
+			return lerr
+		}
+		st.merge(latest, latestVersion)
+		version, err = st.provider.SessionCompareAndSwap(ctx, st.sid, st.version, st.values)
+	}
+	if err != nil {
+		return err
+	}
+	st.version = version
+	st.changes = make(map[interface{}]change)
+	st.flushed = false
+	return nil
+}
+
+// merge rebases the pending changes on latest, the caller must hold st.lock.
+func (st *VersionedStore) merge(latest map[interface{}]interface{}, version uint64) {
+	if latest == nil || st.flushed {
+		latest = make(map[interface{}]interface{})
+	}
+	for k, c := range st.changes {
+		if c.deleted {
+			delete(latest, k)
+		} else {
+			latest[k] = c.value
+		}
+	}
+	st.values = latest
+	st.version = version
+}
+
+// SessionRelease commits the changes of the request, or only refreshes the
+// lifetime of the session when nothing changed and the provider is a Toucher.
+// The response is written by then, so an error can only be logged; call
+// Manager.SessionCommit before writing it to handle conflicts yourself.
+func (st *VersionedStore) SessionRelease(w http.ResponseWriter) {
+	if !st.IsDirty() {
+		if toucher, ok := st.provider.(Toucher); ok {
+			toucher.SessionTouch(st.sid)
+		}
+		return
+	}
+	if err := st.Commit(context.Background()); err != nil {
+		SLogger.Println("session release:", err)
+	}
+}
+
+// Committer is implemented by stores that write their changes back on release
+// and can also do so earlier, reporting the errors SessionRelease can only log.
+type Committer interface {
+	Commit(ctx context.Context) error
+}
+
+// SessionCommit writes the changes made to session so far, before the response
+// is written. Under the "error" conflictPolicy it returns ErrSessionConflict when
+// a parallel request changed the session first, so the handler can answer it,
+// e.g. with 409 Conflict, instead of the change being dropped on release.
+// Stores that are not a Committer have nothing to commit early and return nil.
+//
+//	sess.Set("cart", cart)
+//	if err := globalSessions.SessionCommit(r, sess); err == session.ErrSessionConflict {
+//	    http.Error(w, "cart changed in another tab", http.StatusConflict)
+//	    return
+//	}
+func (manager *Manager) SessionCommit(r *http.Request, session Store) error {
+	c, ok := session.(Committer)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := manager.withTimeout(r.Context())
+	defer cancel()
+	return c.Commit(ctx)
+}
+
+// copyValues returns a shallow copy of values.
+func copyValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	c := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
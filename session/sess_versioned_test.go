@@ -0,0 +1,63 @@
+package session
+
+import (
+	"context"
+	"testing"
+)
+
+func newVersionedMem(t *testing.T) *VersionedMemProvider {
+	pder := &VersionedMemProvider{newMemProvider(4)}
+	if err := pder.SessionInit(3600, ""); err != nil {
+		t.Fatal(err)
+	}
+	return pder
+}
+
+func TestVersionedMemMergesParallelWrites(t *testing.T) {
+	pder := newVersionedMem(t)
+	a, _ := pder.SessionRead("sid")
+	b, _ := pder.SessionRead("sid")
+	a.Set("a", 1)
+	b.Set("b", 2)
+	if err := a.(*VersionedStore).Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(*VersionedStore).Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	values, version, err := pder.SessionLoad(context.Background(), "sid")
+	if err != nil || version != 2 || values["a"] != 1 || values["b"] != 2 {
+		t.Fatalf("got %v at version %d, %v", values, version, err)
+	}
+}
+
+func TestVersionedMemReportsConflict(t *testing.T) {
+	pder := newVersionedMem(t)
+	a, _ := pder.SessionRead("sid")
+	b, _ := pder.SessionRead("sid")
+	b.(*VersionedStore).policy = ConflictError
+	a.Set("k", "a")
+	b.Set("k", "b")
+	if err := a.(*VersionedStore).Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(*VersionedStore).Commit(context.Background()); err != ErrSessionConflict {
+		t.Fatalf("got %v, want ErrSessionConflict", err)
+	}
+	if values, _, _ := pder.SessionLoad(context.Background(), "sid"); values["k"] != "a" {
+		t.Fatalf("the conflicting write landed: %v", values)
+	}
+}
+
+func TestVersionedMemDoesNotResurrect(t *testing.T) {
+	pder := newVersionedMem(t)
+	st, _ := pder.SessionRead("sid")
+	pder.SessionDestroy("sid")
+	st.Set("k", "v")
+	if err := st.(*VersionedStore).Commit(context.Background()); err != ErrSessionConflict {
+		t.Fatalf("got %v, want ErrSessionConflict", err)
+	}
+	if pder.SessionExist("sid") {
+		t.Fatal("the destroyed session came back")
+	}
+}
@@ -13,8 +13,7 @@
 pakcage session
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -23,6 +22,7 @@ import (
 	"net/textproto"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -48,6 +48,61 @@ type Provider interface {
 	SessionGC()
 }
 
+// DirtyStore is implemented by stores that track whether their values were
+// changed by Set, Delete or Flush since they were read. SessionRelease of such
+// a store only writes the session back when it is dirty.
+type DirtyStore interface {
+	Store
+	IsDirty() bool
+}
+
+// ExpiryStore is implemented by stores that know when they expire.
+type ExpiryStore interface {
+	Store
+	IdleExpiry() time.Time     // expiry if the session is not accessed again
+	AbsoluteExpiry() time.Time // expiry regardless of activity, zero if unlimited
+	ExpiresAt() time.Time      // the earlier of both
+}
+
+// Snapshotter is implemented by stores that can copy out all their values.
+type Snapshotter interface {
+	Snapshot() map[interface{}]interface{}
+}
+
+// ExpiryNotifier is implemented by providers that can report the sessions
+// they drop on their own, because they expired or were evicted.
+// The handler must not block, it may run while the provider is busy.
+type ExpiryNotifier interface {
+	SetExpiryHandler(fn func(session Store))
+}
+
+// SessionInfo describes a stored session for administration.
+type SessionInfo struct {
+	SID        string
+	Created    time.Time
+	LastAccess time.Time
+	Size       int // approximate encoded size of the values in bytes
+}
+
+// Inspector is implemented by providers that can enumerate their sessions.
+type Inspector interface {
+	// SessionIterate calls fn for every live session until fn returns false.
+	// fn may call back into the provider.
+	SessionIterate(fn func(info SessionInfo, session Store) bool) error
+}
+
+// GCCounter is implemented by providers that report how many sessions a gc pass removed.
+type GCCounter interface {
+	SessionGCCount() int
+}
+
+// Toucher is implemented by providers that can refresh the lifetime of a
+// session without rewriting its values. Stores call it from SessionRelease
+// when the session was not modified during the request.
+type Toucher interface {
+	SessionTouch(sid string) error
+}
+
 var provides = make(map[string]Provider)
 
 // SLogger a helpful variable to log information about session
@@ -80,12 +135,42 @@ type ManagerConfig struct {
 	EnableSidInHTTPHeader   bool   `json:"EnalbeSidInHTTPHeader"`
 	SessionNameInHTTPHeader string `json:"SessionNameInHTTPHeader"`
 	EnableSidInURLQuery     bool   `json:"EnalbeSidInURLQuery"`
+	BindUserAgent           bool   `json:"bindUserAgent"`     // bind sessions to the client User-Agent
+	BindIPv4Prefix          int    `json:"bindIPv4Prefix"`    // bind sessions to this many leading bits of a client IPv4 address
+	BindIPv6Prefix          int    `json:"bindIPv6Prefix"`    // bind sessions to this many leading bits of a client IPv6 address
+	RotateInterval          int64  `json:"rotateInterval"`    // seconds after which a session gets a new id, 0 disables it
+	RejectUnissuedSid       bool   `json:"rejectUnissuedSid"` // only resume sessions whose id was issued by a Manager
+	DisableHTTPOnly         bool   `json:"disableHTTPOnly"`
+	CookiePath              string `json:"cookiePath"`             // default "/"
+	CookieSameSite          string `json:"cookieSameSite"`         // "lax", "strict", "none" or empty to leave it to the browser
+	ProviderTimeout         int64  `json:"providerTimeout"`        // milliseconds a provider call may take, 0 only uses the request deadline
+	ConflictPolicy          string `json:"conflictPolicy"`         // "merge" (default) or "error" for a concurrently modified versioned session
+	ConflictRetries         int    `json:"conflictRetries"`        // merges tried before giving up, default 3
+	SessionIDSignKey        string `json:"sessionIDSignKey"`       // HMAC key signing session ids, ids without a valid signature are ignored
+	GCJitter                int    `json:"gcJitter"`               // percent of gclifetime each gc interval may deviate by, default 10
+	DisableGCJitter         bool   `json:"disableGCJitter"`        // run the gc at exactly gclifetime, gcJitter is ignored
+	EnableSidInBearerToken  bool   `json:"enableSidInBearerToken"` // read the sid from an "Authorization: Bearer" header
+	SessionTokenHeader      string `json:"sessionTokenHeader"`     // response header a new bearer token is returned in, default X-Session-Token
 }
 
+// defaultGCJitter is the gcJitter percentage used when it is not configured.
+const defaultGCJitter = 10
+
+// cookie name prefixes browsers give extra guarantees for
+const (
+	hostCookiePrefix   = "__Host-"
+	secureCookiePrefix = "__Secure-"
+)
+
 // Manager contains Provider and its configuration.
 type Manager struct {
-	provider Provider
-	cofig *ManagerConfig
+	provider    ContextProvider
+	base        interface{} // the registered provider, checked for the optional interfaces
+	config      *ManagerConfig
+	sameSite    http.SameSite
+	idGenerator IDGenerator
+	janitor     *Janitor
+	events      events
 }
 
 // NewManager Create new Manager with provider name and json config string.
@@ -101,8 +186,13 @@ type Manager struct {
 // 3. hashkey default beegosesionkey
 // 4. maxage default is none
 func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
-	provider, ok := provider[provideName]
-	if !ok {
+	var provider ContextProvider
+	var base interface{}
+	if p, ok := provides[provideName]; ok {
+		provider, base = WrapProvider(p), p
+	} else if p, ok := contextProvides[provideName]; ok {
+		provider, base = p, p
+	} else {
 		return nil, fmt.Errorf("session: unknown provide %q (forgotten import?)", provideName)
 	}
 
@@ -110,6 +200,35 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		cf.maxlifetime = cf.Gclifetime
 	}
 
+	if cf.BindIPv4Prefix < 0 || cf.BindIPv4Prefix > 32 {
+		return nil, fmt.Errorf("session: bindIPv4Prefix %d is out of range [0, 32]", cf.BindIPv4Prefix)
+	}
+	if cf.BindIPv6Prefix < 0 || cf.BindIPv6Prefix > 128 {
+		return nil, fmt.Errorf("session: bindIPv6Prefix %d is out of range [0, 128]", cf.BindIPv6Prefix)
+	}
+
+	if cf.CookiePath == "" {
+		cf.CookiePath = "/"
+	}
+	sameSite, err := parseSameSite(cf.CookieSameSite)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCookieConfig(cf, sameSite); err != nil {
+		return nil, err
+	}
+
+	switch cf.ConflictPolicy {
+	case "":
+		cf.ConflictPolicy = ConflictMerge
+	case ConflictMerge, ConflictError:
+	default:
+		return nil, fmt.Errorf("session: unknown conflictPolicy %q, it should be merge or error", cf.ConflictPolicy)
+	}
+	if cf.ConflictRetries <= 0 {
+		cf.ConflictRetries = defaultConflictRetries
+	}
+
 	if cf.EnableSidInHTTPHeader {
 		if cf.SessionNameInHTTPHeader == "" {
 			panic(errors.New("SessionNameInHTTPHeader is empty"))
@@ -122,19 +241,45 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		}
 	}
 
-	err := provider.SessionInit(cf.Maxlifetime, cf.ProviderConfig)
+	if cf.EnableSidInBearerToken && cf.SessionTokenHeader == "" {
+		cf.SessionTokenHeader = defaultSessionTokenHeader
+	}
+
+	err = provider.SessionInit(cf.Maxlifetime, cf.ProviderConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	if cf.DisableGCJitter {
+		cf.GCJitter = 0
+	} else if cf.GCJitter == 0 {
+		cf.GCJitter = defaultGCJitter
+	}
+	if cf.GCJitter < 0 || cf.GCJitter >= 100 {
+		return nil, fmt.Errorf("session: gcJitter %d is out of range [0, 100)", cf.GCJitter)
+	}
+
 	if cf.SessionIDLength == 0 {
 		cf.SessionIDLength = 16
 	}
 
-	return &Manager{
-		provider,
-		cf,
-	}, nil
+	manager := &Manager{
+		provider:    provider,
+		base:        base,
+		config:      cf,
+		sameSite:    sameSite,
+		idGenerator: HexIDGenerator{Length: int(cf.SessionIDLength)},
+	}
+	manager.janitor = &Janitor{
+		provider: provider,
+		base:     base,
+		interval: time.Duration(cf.Gclifetime) * time.Second,
+		jitter:   float64(cf.GCJitter) / 100,
+	}
+	if notifier, ok := base.(ExpiryNotifier); ok {
+		notifier.SetExpiryHandler(manager.expired)
+	}
+	return manager, nil
 }
 
 // getSid retrives session identifier from HTTP Request.
@@ -144,8 +289,28 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 // error is not nil when there is anything wrong.
 // sid is empty when need to generate a new session id.
 // otherwise return an valid session id.
+// A sid with a missing or forged signature is treated as absent, before any provider sees it.
 func (manager *Manager) getSid(r *http.Request) (string, error) {
-	cookie, errs := r.Cookie(manager.config.CookieName)
+	sid, err := manager.readSid(r)
+	if err != nil || sid == "" {
+		return sid, err
+	}
+	if !manager.verify(sid) {
+		SLogger.Println("rejected a session id with a missing or invalid signature")
+		return "", nil
+	}
+	return sid, nil
+}
+
+// readSid returns the sid the request carries, unverified.
+// A bearer token that is the id of a stored session takes precedence over
+// every other carrier, any other bearer token is left to whom it is meant for.
+func (manager *Manager) readSid(r *http.Request) (string, error) {
+	if sid := manager.bearerSid(r); sid != "" {
+		return sid, nil
+	}
+
+	cookie, err := r.Cookie(manager.config.CookieName)
 	if err != nil || cookie.Value == "" {
 		var sid string
 		if manager.config.EnableSidInURLQuery {
@@ -160,7 +325,7 @@ func (manager *Manager) getSid(r *http.Request) (string, error) {
 		// if not found in Cookie / param, then read it from request headers
 		if manager.config.EnableSidInHTTPHeader && sid == "" {
 			sids, isFound := r.Header[manager.config.SessionNameInHTTPHeader]
-			if isFound && len(sids) != {
+			if isFound && len(sids) != 0 {
 				return sids[0], nil
 			}
 		}
@@ -173,49 +338,112 @@ func (manager *Manager) getSid(r *http.Request) (string, error) {
 
 // SessionStart generate or read the session id from http request.
 // if session id exists, return SessionStore with this id.
+// A session that was not issued to this client is never resumed, a new one is started instead.
+// A session older than RotateInterval is resumed under a new id.
+// The provider calls are bound to the context of r.
 func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (session Store, err error) {
 	sid, errs := manager.getSid(r)
 	if errs != nil {
 		return nil, errs
 	}
 
-	if sid != "" && manager.provider.SessionExist(sid) {
-		return manager.provider.SessionRead(sid)
+	ctx, cancel := manager.withTimeout(r.Context())
+	defer cancel()
+	if sid != "" {
+		exist, err := manager.provider.SessionExist(ctx, sid)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			session, err = manager.provider.SessionRead(ctx, sid)
+			if err != nil {
+				return nil, err
+			}
+			if manager.trusted(session, r) {
+				if manager.rotationDue(session) {
+					return manager.regenerate(ctx, w, r, sid)
+				}
+				return manager.adopt(session), nil
+			}
+		}
 	}
 
 	// Generate a new session
-	sid, errs = manager.sessionID()
-	if errs != nil {
-		return nil, errs
+	return manager.regenerate(ctx, w, r, "")
+}
+
+// withTimeout bounds the provider calls made with parent by ProviderTimeout.
+func (manager *Manager) withTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if manager.config.ProviderTimeout > 0 {
+		return context.WithTimeout(parent, time.Duration(manager.config.ProviderTimeout)*time.Millisecond)
 	}
+	return context.WithCancel(parent)
+}
 
-	session, err = manager.provider.SessionRead(sid)
+// regenerate moves the session of oldsid to a new id, or starts an empty session
+// when oldsid is empty, and hands the new id to the client.
+// The caller must have checked that oldsid may be resumed by r.
+func (manager *Manager) regenerate(ctx context.Context, w http.ResponseWriter, r *http.Request, oldsid string) (session Store, err error) {
+	sid, err := manager.sessionID()
 	if err != nil {
 		return nil, err
 	}
-	cookie := &http.Cookie{
-		Name:     manager.config.CookieName,
-		Value:    url.QueryEscape(sid),
-		Path:     "/",
-		HttpOnly: !manager.config.DisableHTTPOnly,
-		Secure:   manager.isSecure(r),
-		Domain:   manger.config.Domain,
+
+	// only a bearer token carrying the old id is replaced, any other one is a credential of its own
+	bearer := oldsid != "" && manager.config.EnableSidInBearerToken && bearerToken(r) == oldsid
+	if oldsid != "" {
+		session, err = manager.provider.SessionRegenerate(ctx, oldsid, sid)
+	} else {
+		session, err = manager.provider.SessionRead(ctx, sid)
 	}
+	if err != nil {
+		return nil, err
+	}
+	manager.adopt(session)
+	manager.issue(session, r)
+	manager.setSid(w, r, sid, bearer)
+	if oldsid != "" {
+		manager.events.fire(eventRegenerate, session, oldsid)
+	} else {
+		manager.events.fire(eventCreate, session, "")
+	}
+	return session, nil
+}
+
+// setSid hands sid to the client in the session cookie and, if enabled, the session header
+// and the session token header.
+// The request is updated too, so the rest of the request sees the new id. Its
+// Authorization header is only rewritten when bearer reports that the old id came from it.
+func (manager *Manager) setSid(w http.ResponseWriter, r *http.Request, sid string, bearer bool) {
+	cookie := manager.cookie(r, url.QueryEscape(sid))
 	if manager.config.CookieLifeTime > 0 {
-		cookie.MaxAge = manger.config.CookieLifeTime
+		cookie.MaxAge = manager.config.CookieLifeTime
 		cookie.Expires = time.Now().Add(time.Duration(manager.config.CookieLifeTime) * time.Second)
 	}
 	if manager.config.EnableSetCookie {
 		http.SetCookie(w, cookie)
 	}
+
+	// drop the id the request came with, r.Cookie returns the first match
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != manager.config.CookieName {
+			r.AddCookie(c)
+		}
+	}
 	r.AddCookie(cookie)
 
 	if manager.config.EnableSidInHTTPHeader {
 		r.Header.Set(manager.config.SessionNameInHTTPHeader, sid)
 		w.Header().Set(manager.config.SessionNameInHTTPHeader, sid)
 	}
-
-	return
+	if manager.config.EnableSidInBearerToken {
+		if bearer {
+			r.Header.Set("Authorization", "Bearer "+sid)
+		}
+		w.Header().Set(manager.config.SessionTokenHeader, sid)
+	}
 }
 
 // SessionDestroy Destroy session by its id in http request cookie
@@ -224,81 +452,138 @@ func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 		r.Header.Del(manager.config.SessionNameInHTTPHeader)
 		w.Header().Del(manager.config.SessionNameInHTTPHeader)
 	}
+	if sid := manager.bearerSid(r); sid != "" {
+		ctx, cancel := manager.withTimeout(r.Context())
+		defer cancel()
+		manager.destroy(ctx, sid)
+		r.Header.Del("Authorization")
+	}
+	if manager.config.EnableSidInBearerToken {
+		w.Header().Del(manager.config.SessionTokenHeader)
+	}
 
 	cookie, err := r.Cookie(manager.config.CookieName)
 	if err != nil || cookie.Value == "" {
 		return
 	}
 
-	sid, _ := url.QueryUnescape(cookie.Value)
-	manager.provider.SessionDestroy(sid)
+	if sid, _ := url.QueryUnescape(cookie.Value); manager.verify(sid) {
+		ctx, cancel := manager.withTimeout(r.Context())
+		defer cancel()
+		manager.destroy(ctx, sid)
+	}
 	if manager.config.EnableSetCookie {
-		expiration := time.Now()
-		cookie = &http.Cookie{
-			Name:     manager.config.CookieName,
-			Path:     "/",
-			HttpOnly: !manager.config.DisableHTTPOnly,
-			Expires:  expiration,
-			MaxAge:   -1
-		}
-
+		// the browser only drops the cookie when path and domain match the ones it was set with
+		cookie = manager.cookie(r, "")
+		cookie.Expires = time.Now()
+		cookie.MaxAge = -1
 		http.SetCookie(w, cookie)
 	}
 }
 
+// destroy removes the session sid from the provider and fires OnDestroy.
+func (manager *Manager) destroy(ctx context.Context, sid string) error {
+	var session Store
+	if exist, _ := manager.provider.SessionExist(ctx, sid); exist {
+		session, _ = manager.provider.SessionRead(ctx, sid)
+	}
+	if err := manager.provider.SessionDestroy(ctx, sid); err != nil {
+		return err
+	}
+	if session != nil {
+		manager.events.fire(eventDestroy, session, "")
+	}
+	return nil
+}
+
+// cookie returns the session cookie carrying value with the configured attributes.
+func (manager *Manager) cookie(r *http.Request, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     manager.config.CookieName,
+		Value:    value,
+		Path:     manager.config.CookiePath,
+		HttpOnly: !manager.config.DisableHTTPOnly,
+		// prefixed cookies are dropped by the browser without Secure, even behind a TLS terminating proxy
+		Secure:   manager.isSecure(r) || strings.HasPrefix(manager.config.CookieName, secureCookiePrefix) || strings.HasPrefix(manager.config.CookieName, hostCookiePrefix),
+		Domain:   manager.config.Domain,
+		SameSite: manager.sameSite,
+	}
+}
+
 // GetSessionStore Get SessionStore by its id.
 func (manager *Manager) GetSessionStore(sid string) (session Store, err error) {
-	sessions, err = manager.provider.SessionRead(sid)
-	return
+	return manager.GetSessionStoreContext(context.Background(), sid)
+}
+
+// GetSessionStoreContext Get SessionStore by its id, giving up when ctx is done.
+func (manager *Manager) GetSessionStoreContext(ctx context.Context, sid string) (session Store, err error) {
+	ctx, cancel := manager.withTimeout(ctx)
+	defer cancel()
+	session, err = manager.provider.SessionRead(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	return manager.adopt(session), nil
+}
+
+// adopt applies the conflict settings of the manager to a versioned session.
+func (manager *Manager) adopt(session Store) Store {
+	st, ok := session.(*VersionedStore)
+	if tiered, isTiered := session.(*TieredSessionStore); isTiered {
+		st, ok = tiered.Store.(*VersionedStore)
+	}
+	if ok {
+		st.lock.Lock()
+		st.policy = manager.config.ConflictPolicy
+		st.retries = manager.config.ConflictRetries
+		st.lock.Unlock()
+	}
+	return session
 }
 
 // GC start session gc process.
-// it can do gc in times after gc lifetime.
+// it can do gc in times after gc lifetime, until StopGC or StopJanitors is called.
 func (manager *Manager) GC() {
-	manager.provider.SessionGC()
-	time.AfterFunc(time.Duration(manager.config.Gclifetime)*time.Second, func(){ manager.GC()})
+	manager.janitor.Run()
+	manager.janitor.Start()
+}
+
+// StopGC stops the session gc process started by GC.
+func (manager *Manager) StopGC() {
+	manager.janitor.Stop()
 }
 
 // SessionRegenerateID Regenerate a session id for this SessionStore who's id is saving in http request.
-func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Request) (Session Store) {
-	sid, err := manager.sessionID()
-	if err != nil {
-		return
+// The values are only carried over when the old session may be resumed by r.
+func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Request) (session Store) {
+	oldsid, _ := manager.getSid(r)
+	ctx, cancel := manager.withTimeout(r.Context())
+	defer cancel()
+	if oldsid != "" && !manager.resumable(ctx, oldsid, r) {
+		oldsid = ""
 	}
-	cookie, err := r.Cookie(manager.config.CookieName)
-	if err != nil || cookie.Value == "" {
-		// delete old cookie
-		session, _ = mangager.provider.SessionRead(sid)
-		cooki = &http.Cookie {
-			Name:     manager.config.CookieName,
-			Value:    url.QuerySapce(sid),
-			Path:     "/",
-			HttpOnly: !manager.config.DisableHTTPOnly,
-			Secure:   manager.isSecure(r),
-			Domain:   manager.config.Domain,
-		}
-	} else {
-		oldsid, _ := url.QueryUnescape(cookie.Value)
-		session, _ = manager.provider.SessionRegenerate(oldsid, sid)
-		cookie.Value = url.QueryEscape(sid)
-		cookie.HttpOnly = true
-		cookie.Path = "/"
-	}
-	if manager.config.CookieLifeTime >0 {
-		cookie.MaxAge = manager.config.CookieLifeTime
-		cookie.Expires = time.Now().Add(time.Duration(manager.config.CookieLifeTime) * time.Second)
+	session, _ = manager.regenerate(ctx, w, r, oldsid)
+	return
+}
+
+// SessionChangePrivilege gives the session of r a new id and then stores value under key.
+// Call it whenever the privileges of a session change, e.g. on login or sudo,
+// so that an id planted or captured before the change cannot be used afterwards.
+func (manager *Manager) SessionChangePrivilege(w http.ResponseWriter, r *http.Request, key, value interface{}) (Store, error) {
+	oldsid, err := manager.getSid(r)
+	if err != nil {
+		return nil, err
 	}
-	if manager.config.EnalbeSetCookie {
-		http.SetCookie(w, cookie)
+	ctx, cancel := manager.withTimeout(r.Context())
+	defer cancel()
+	if oldsid != "" && !manager.resumable(ctx, oldsid, r) {
+		oldsid = ""
 	}
-	r.AddCookie(cookie)
-
-	if manager.config.EnableSidInHTTPHeader {
-		r.Header.Set(manager.config.SessionNameInHTTPHeader, sid)
-		w.Header().Set(manager.config.Set, sid)
+	session, err := manager.regenerate(ctx, w, r, oldsid)
+	if err != nil {
+		return nil, err
 	}
-
-	return
+	return session, session.Set(key, value)
 }
 
 // GetActiveSession Get all active session count number.
@@ -312,12 +597,11 @@ func (manager *Manager) SetSecure(secure bool) {
 }
 
 func (manager *Manager) sessionID() (string, error) {
-	b := make([]byte, manager.config.SesionIDLength)
-	n, err := rand.Read(b)
-	if n!= len(b) || err != nil {
-		return "", fmt.Errorf("Counld not successfully read from the system CSPRNG")
+	id, err := manager.idGenerator.NewID()
+	if err != nil {
+		return "", err
 	}
-	return hex.EncodeToString(b), nil
+	return manager.sign(id), nil
 }
 
 // Set cookie with https.
@@ -334,6 +618,45 @@ func (manager *Manager) isSecure(req *http.Request) bool {
 	return true
 }
 
+// parseSameSite converts the cookieSameSite config to http.SameSite.
+func parseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(mode) {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, fmt.Errorf("session: unknown cookieSameSite %q, it should be lax, strict or none", mode)
+}
+
+// checkCookieConfig enforces the rules browsers apply to SameSite=None and to
+// the __Host- and __Secure- cookie name prefixes, so a misconfigured cookie
+// fails at startup instead of being silently dropped by the browser.
+func checkCookieConfig(cf *ManagerConfig, sameSite http.SameSite) error {
+	if sameSite == http.SameSiteNoneMode && !cf.Secure {
+		return errors.New("session: cookieSameSite none requires secure")
+	}
+	if strings.HasPrefix(cf.CookieName, hostCookiePrefix) {
+		if !cf.Secure {
+			return fmt.Errorf("session: cookie %q requires secure", cf.CookieName)
+		}
+		if cf.Domain != "" {
+			return fmt.Errorf("session: cookie %q must not set a domain", cf.CookieName)
+		}
+		if cf.CookiePath != "/" {
+			return fmt.Errorf("session: cookie %q must use path \"/\"", cf.CookieName)
+		}
+	}
+	if strings.HasPrefix(cf.CookieName, secureCookiePrefix) && !cf.Secure {
+		return fmt.Errorf("session: cookie %q requires secure", cf.CookieName)
+	}
+	return nil
+}
+
 // Log implement the log.Logger
 type log struct {
 	*log.Logger
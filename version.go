@@ -0,0 +1,188 @@
+package beego
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultVersionHeader = "X-API-Version"
+	defaultVersionParam  = "version"
+)
+
+// apiVersionKey is the request context key of the API version the request was routed to.
+type apiVersionKey struct{}
+
+// VersionConfig tells how a router selects the API version of a request.
+type VersionConfig struct {
+	Header  string // request header naming the version, "X-API-Version" when empty
+	Param   string // parameter of the Accept media types naming the version, "version" when empty
+	Default string // version of the requests naming none, "" to answer them 406 on versioned paths
+}
+
+// Version returns the router for the routes of API version v, creating it on
+// first use. Routes, filters and namespaces are registered on it as on any
+// ControllerRegister. Like a host router, it runs the filters of p first and
+// the middlewares of p around its own.
+//
+// A request is routed to version v when its version header or a "version"
+// parameter of its Accept header names v, see SetVersionConfig, and version v
+// has a route for its path. A request for a path only other versions route is
+// answered 406 Not Acceptable, except for OPTIONS requests, which a preflight
+// sends without the version header, so they go to a version routing the path.
+// Paths no version routes are served by p.
+// usage:
+//     v1 := beego.BeeApp.Handlers.Version("1")
+//     v1.Add("/user/:id:int", &UserV1Controller{})
+//     v2 := beego.BeeApp.Handlers.Version("2")
+//     v2.Add("/user/:id:int", &UserV2Controller{})
+//     beego.BeeApp.Handlers.SetVersionConfig(beego.VersionConfig{Default: "2"})
+//
+//     GET /user/1 with "X-API-Version: 1" or "Accept: application/json; version=1" is served by UserV1Controller
+func (p *ControllerRegister) Version(v string) *ControllerRegister {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		panic("beego: empty API version")
+	}
+	if r, ok := p.versions[v]; ok {
+		return r
+	}
+	if p.versions == nil {
+		p.versions = make(map[string]*ControllerRegister)
+	}
+	r := p.child()
+	p.versions[v] = r
+	return r
+}
+
+func (c VersionConfig) header() string {
+	if c.Header == "" {
+		return defaultVersionHeader
+	}
+	return c.Header
+}
+
+// SetVersionConfig sets how p selects the API version of a request.
+func (p *ControllerRegister) SetVersionConfig(c VersionConfig) {
+	p.versioning = c
+}
+
+// requestedVersion returns the API version the request names, or the default one.
+func (p *ControllerRegister) requestedVersion(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get(p.versioning.header())); v != "" {
+		return v
+	}
+	param := p.versioning.Param
+	if param == "" {
+		param = defaultVersionParam
+	}
+	for _, accept := range r.Header[http.CanonicalHeaderKey("Accept")] {
+		for _, mediaType := range strings.Split(accept, ",") {
+			params := strings.Split(mediaType, ";")
+			for _, kv := range params[1:] {
+				kv = strings.TrimSpace(kv)
+				if i := strings.IndexByte(kv, '='); i > 0 && strings.EqualFold(strings.TrimSpace(kv[:i]), param) {
+					if v := strings.Trim(strings.TrimSpace(kv[i+1:]), `"`); v != "" {
+						return v
+					}
+				}
+			}
+		}
+	}
+	return p.versioning.Default
+}
+
+// serveVersion serves the request with the router of the API version it names,
+// answers 406 when its method and path are routed for other versions only, and
+// serves it with p otherwise. Every answer varies by the version header and Accept.
+func (p *ControllerRegister) serveVersion(rw http.ResponseWriter, r *http.Request) {
+	if len(p.versions) == 0 {
+		p.serveRoute(rw, r)
+		return
+	}
+	header := p.versioning.header()
+	rw.Header().Add("Vary", header+", Accept")
+	method, urlPath := r.Method, r.URL.Path
+	v := p.requestedVersion(r)
+	vr := p.versions[v]
+	switch {
+	case vr != nil && vr.routes(method, urlPath):
+	case method == http.MethodOptions:
+		// a preflight names no version, a version routing the path answers it
+		if vr == nil || len(vr.AllowedMethods(urlPath)) == 0 {
+			v, vr = p.routingVersion(func(vr *ControllerRegister) bool {
+				return len(vr.AllowedMethods(urlPath)) > 0
+			})
+		}
+	default:
+		if _, other := p.routingVersion(func(vr *ControllerRegister) bool { return vr.routes(method, urlPath) }); other != nil {
+			// ErrorMaps has no 406 page, exception would answer 503
+			http.Error(rw, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+			return
+		}
+		if vr != nil && len(vr.AllowedMethods(urlPath)) == 0 {
+			// vr answers 405 for the paths it routes for other methods
+			vr = nil
+		}
+	}
+	if vr == nil {
+		p.serveRoute(rw, r)
+		return
+	}
+	rw.Header().Set(header, v)
+	vr.serveRoute(rw, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, v)))
+}
+
+// routes reports whether p has a route for method and urlPath.
+func (p *ControllerRegister) routes(method, urlPath string) bool {
+	_, _, found := p.lookup(nil, method, urlPath)
+	return found
+}
+
+// routingVersion returns the lowest version whose router routes reports true
+// for, and its router, or a nil router when there is none.
+func (p *ControllerRegister) routingVersion(routes func(*ControllerRegister) bool) (string, *ControllerRegister) {
+	versions := make([]string, 0, len(p.versions))
+	for v := range p.versions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versionLess(versions[i], versions[j])
+	})
+	for _, v := range versions {
+		if routes(p.versions[v]) {
+			return v, p.versions[v]
+		}
+	}
+	return "", nil
+}
+
+// versionLess orders versions such as "9", "10" and "v1.2" by the numbers of
+// their dot separated parts, parts that aren't numbers compare as text.
+func versionLess(a, b string) bool {
+	as := strings.Split(strings.TrimLeft(a, "vV"), ".")
+	bs := strings.Split(strings.TrimLeft(b, "vV"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		if aerr == nil && berr == nil && an != bn {
+			return an < bn
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// APIVersion returns the API version the request was routed to, "" for unversioned routes.
+// usage:
+//     if beego.APIVersion(c.Ctx.Request) == "1" {
+func APIVersion(r *http.Request) string {
+	v, _ := r.Context().Value(apiVersionKey{}).(string)
+	return v
+}